@@ -2,20 +2,41 @@ package main
 
 import (
 	"VCSProject/vcs"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 )
 
 func main() {
+	// 取出action之前的--repo，之後的參數位置與沒有指定時相同
+	repo, args, err := parseRepoArgs(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error:", err)
+		fmt.Println("Usage: vcs [--repo <path>] <action> [<args>]")
+		return
+	}
+	os.Args = append(os.Args[:1], args...)
+
 	// 創建VCS
-	vcs := vcs.NewVCS()
+	vcs := newVCS(repo)
 
 	// 檢查是否有action參數
 	if len(os.Args) < 2 {
-		fmt.Println("Error: action is required (init, add, remove, commit, status, log, checkout, create-branch, checkout-branch, merge)")
+		fmt.Println("Error: action is required (init, add, remove, commit, status, diff, log, checkout, create-branch, checkout-branch, merge, merge-base, tag, branch, fsck, gc)")
 		return
 	}
 
+	// 清理上次中斷的操作留下的不完整版本與暫存檔；fsck要如實回報這些檔案，不先清理
+	if os.Args[1] != "init" && os.Args[1] != "fsck" && os.Args[1] != "verify" {
+		err := vcs.Recover()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+
 	// 根據action執行不同的邏輯
 	switch os.Args[1] {
 	case "init":
@@ -25,12 +46,14 @@ func main() {
 		}
 	case "add":
 		if len(os.Args) < 3 {
-			fmt.Println("Usage: add <filename>")
+			fmt.Println("Usage: add <filename or directory>...")
 			return
 		}
-		err := vcs.Add(os.Args[2])
-		if err != nil {
-			fmt.Println("Error:", err)
+		for _, filename := range os.Args[2:] {
+			err := vcs.Add(filename)
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
 		}
 	case "remove":
 		if len(os.Args) < 3 {
@@ -56,57 +79,341 @@ func main() {
 			fmt.Println("Error:", err)
 		}
 	case "status":
-		err := vcs.Status()
+		short := len(os.Args) > 2 && (os.Args[2] == "--short" || os.Args[2] == "--porcelain")
+		err := vcs.Status(short)
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "diff":
+		staged := false
+		revisions := []string{}
+		for _, arg := range os.Args[2:] {
+			if arg == "--staged" || arg == "--cached" {
+				staged = true
+			} else {
+				revisions = append(revisions, arg)
+			}
+		}
+		err := vcs.Diff(staged, revisions...)
 		if err != nil {
 			fmt.Println("Error:", err)
 		}
 	case "checkout":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: checkout <version number>")
+		options, args, err1 := parseCheckoutArgs("checkout", os.Args[2:])
+		if err1 != nil || len(args) != 1 {
+			if err1 != nil {
+				fmt.Println("Error:", err1)
+			}
+			fmt.Println("Usage: checkout [--force | --merge] <revision>")
+			return
+		}
+		err := vcs.Checkout(args[0], options)
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "create-branch":
+		flags := flag.NewFlagSet("create-branch", flag.ContinueOnError)
+		noSwitch := flags.Bool("no-switch", false, "create the branch without checking it out")
+		args, err1 := parseFlags(flags, os.Args[2:])
+		if err1 != nil || len(args) < 1 || len(args) > 2 {
+			if err1 != nil {
+				fmt.Println("Error:", err1)
+			}
+			fmt.Println("Usage: create-branch [--no-switch] <branch name> [<revision>]")
 			return
 		}
-		var version int
-		_, err1 := fmt.Sscanf(os.Args[2], "%d", &version)
+		revision := ""
+		if len(args) > 1 {
+			revision = args[1]
+		}
+		err := vcs.CreateBranch(args[0], revision, !*noSwitch)
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "checkout-branch":
+		options, args, err1 := parseCheckoutArgs("checkout-branch", os.Args[2:])
+		if err1 != nil || len(args) != 1 {
+			if err1 != nil {
+				fmt.Println("Error:", err1)
+			}
+			fmt.Println("Usage: checkout-branch [--force | --merge] <branch name>")
+			return
+		}
+		err := vcs.CheckoutBranch(args[0], options)
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "merge":
+		if len(os.Args) == 3 && os.Args[2] == "--continue" {
+			err := vcs.MergeContinue()
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
+			return
+		}
+		if len(os.Args) == 3 && os.Args[2] == "--abort" {
+			err := vcs.MergeAbort()
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
+			return
+		}
+
+		options, args, err1 := parseMergeArgs(os.Args[2:])
 		if err1 != nil {
-			fmt.Println("The version number format is incorrect.")
+			fmt.Println("Error:", err1)
+		}
+		if err1 != nil || len(args) != 2 {
+			fmt.Println("Usage: merge [--dry-run [--stat]] [--ff|--no-ff|--ff-only] [--strategy=recursive|ours|theirs|union] [--strategy-path=<pattern>=<strategy>]... <target branch name> <source revision> | merge --continue | merge --abort")
 			return
 		}
-		err2 := vcs.Checkout(version)
+		targetBranch := args[0]
+		sourceBranch := args[1]
+
+		_, err2 := vcs.Merge(targetBranch, sourceBranch, options)
 		if err2 != nil {
 			fmt.Println("Error:", err2)
 		}
-	case "create-branch":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: create-branch <branch name>")
+	case "branch":
+		flags := flag.NewFlagSet("branch", flag.ContinueOnError)
+		remove := flags.Bool("d", false, "delete a merged branch")
+		forceRemove := flags.Bool("D", false, "delete a branch even if it is not merged")
+		rename := flags.Bool("m", false, "rename a branch")
+		showCurrent := flags.Bool("show-current", false, "print the current branch")
+		args, err1 := parseFlags(flags, os.Args[2:])
+		valid := err1 == nil
+		switch {
+		case *remove || *forceRemove:
+			valid = valid && len(args) == 1
+		case *rename:
+			valid = valid && (len(args) == 1 || len(args) == 2)
+		default:
+			valid = valid && len(args) == 0
+		}
+		if !valid {
+			if err1 != nil {
+				fmt.Println("Error:", err1)
+			}
+			fmt.Println("Usage: branch | branch --show-current | branch -d|-D <branch name> | branch -m [<old name>] <new name>")
 			return
 		}
-		err := vcs.CreateBranch(os.Args[2])
+
+		var err error
+		switch {
+		case *remove || *forceRemove:
+			err = vcs.DeleteBranch(args[0], *forceRemove)
+		case *rename && len(args) == 1:
+			err = vcs.RenameCurrentBranch(args[0])
+		case *rename:
+			err = vcs.RenameBranch(args[0], args[1])
+		case *showCurrent:
+			err = vcs.ShowCurrentBranch()
+		default:
+			err = vcs.ListBranches()
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 		}
-	case "checkout-branch":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: checkout-branch <branch name>")
+	case "tag":
+		flags := flag.NewFlagSet("tag", flag.ContinueOnError)
+		annotated := flags.Bool("a", false, "create an annotated tag")
+		message := flags.String("m", "", "tag message")
+		remove := flags.Bool("d", false, "delete the tag")
+		force := flags.Bool("f", false, "replace an existing tag")
+		list := flags.Bool("l", false, "list tags")
+		args, err1 := parseFlags(flags, os.Args[2:])
+		if err1 != nil || len(args) > 2 || (*remove && len(args) != 1) {
+			if err1 != nil {
+				fmt.Println("Error:", err1)
+			}
+			fmt.Println("Usage: tag [-l] | tag [-a] [-m <message>] [-f] <tag name> [<revision>] | tag -d <tag name>")
 			return
 		}
-		err := vcs.CheckoutBranch(os.Args[2])
+
+		var err error
+		switch {
+		case *remove:
+			err = vcs.DeleteTag(args[0])
+		case *list || len(args) == 0:
+			err = vcs.ListTags()
+		default:
+			revision := ""
+			if len(args) > 1 {
+				revision = args[1]
+			}
+			err = vcs.CreateTag(args[0], revision, *message, *annotated || *message != "", *force)
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 		}
-	case "merge":
+	case "merge-base":
 		if len(os.Args) < 4 {
-			fmt.Println("Usage: merge <target branch name> <source branch name>")
+			fmt.Println("Usage: merge-base <revision> <revision>")
 			return
 		}
-		targetBranch := os.Args[2]
-		sourceBranch := os.Args[3]
-
-		err := vcs.Merge(targetBranch, sourceBranch)
+		err := vcs.MergeBase(os.Args[2], os.Args[3])
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	case "fsck", "verify":
+		code, err := vcs.Verify()
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+		os.Exit(code)
+	case "gc":
+		options, args, err1 := parseGCArgs(os.Args[2:])
+		if err1 != nil || len(args) != 0 {
+			if err1 != nil {
+				fmt.Println("Error:", err1)
+			}
+			fmt.Println("Usage: gc [--prune=<date>] [--repack]")
+			return
+		}
+		err := vcs.GC(options)
 		if err != nil {
 			fmt.Println("Error:", err)
 		}
 	default:
-		fmt.Println("Error: invalid action. Choices are (init, add, remove, commit, status, log, checkout, create-branch, checkout-branch, merge)")
+		fmt.Println("Error: invalid action. Choices are (init, add, remove, commit, status, diff, log, checkout, create-branch, checkout-branch, merge, merge-base, tag, branch, fsck, gc)")
 		return
 	}
 }
+
+// 解析action之前的--repo <path>或--repo=<path>，回傳指定的工作目錄與剩下的參數
+func parseRepoArgs(args []string) (string, []string, error) {
+	repo := ""
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--repo" || args[0] == "-repo":
+			if len(args) < 2 || args[1] == "" {
+				return "", nil, fmt.Errorf("--repo requires a path")
+			}
+			repo, args = args[1], args[2:]
+		case strings.HasPrefix(args[0], "--repo=") || strings.HasPrefix(args[0], "-repo="):
+			repo = args[0][strings.Index(args[0], "=")+1:]
+			if repo == "" {
+				return "", nil, fmt.Errorf("--repo requires a path")
+			}
+			args = args[1:]
+		default:
+			return repo, args, nil
+		}
+	}
+	return repo, args, nil
+}
+
+// 依--repo、環境變數VCS_DIR或目前資料夾的上層找到工作目錄，創建VCS
+func newVCS(repo string) *vcs.VCS {
+	if repo != "" {
+		return vcs.NewVCSAt(repo)
+	}
+	return vcs.NewVCS()
+}
+
+// 解析指令的旗標，旗標可以出現在位置參數之前或之間，回傳位置參數
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	positional := []string{}
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// --strategy旗標
+type mergeStrategyFlag struct {
+	strategy *vcs.MergeStrategy
+}
+
+func (f mergeStrategyFlag) String() string {
+	if f.strategy == nil {
+		return ""
+	}
+	return string(*f.strategy)
+}
+
+func (f mergeStrategyFlag) Set(value string) error {
+	strategy, err := vcs.ParseMergeStrategy(value)
+	if err != nil {
+		return err
+	}
+	*f.strategy = strategy
+	return nil
+}
+
+// 可重複指定的--strategy-path旗標，格式為<pattern>=<strategy>
+type pathStrategyFlag struct {
+	rules *[]vcs.PathStrategy
+}
+
+func (f pathStrategyFlag) String() string {
+	return ""
+}
+
+func (f pathStrategyFlag) Set(value string) error {
+	pattern, name, found := strings.Cut(value, "=")
+	if !found || pattern == "" {
+		return fmt.Errorf("expected <pattern>=<strategy>, got %q", value)
+	}
+	strategy, err := vcs.ParseMergeStrategy(name)
+	if err != nil {
+		return err
+	}
+	*f.rules = append(*f.rules, vcs.PathStrategy{Pattern: pattern, Strategy: strategy})
+	return nil
+}
+
+// 解析merge指令的參數
+func parseMergeArgs(args []string) (vcs.MergeOptions, []string, error) {
+	options := vcs.MergeOptions{}
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	flags.Var(mergeStrategyFlag{&options.Strategy}, "strategy", "merge strategy")
+	flags.Var(pathStrategyFlag{&options.PathStrategies}, "strategy-path", "merge strategy for matching paths")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "show what the merge would do without changing anything")
+	flags.BoolVar(&options.Diffstat, "stat", false, "show a diffstat of the merge")
+	flags.BoolFunc("ff", "fast-forward when possible", func(string) error {
+		options.FastForward = vcs.FastForwardAuto
+		return nil
+	})
+	flags.BoolFunc("no-ff", "always create a merge version", func(string) error {
+		options.FastForward = vcs.NoFastForward
+		return nil
+	})
+	flags.BoolFunc("ff-only", "refuse to merge unless fast-forward is possible", func(string) error {
+		options.FastForward = vcs.FastForwardOnly
+		return nil
+	})
+	positional, err := parseFlags(flags, args)
+	return options, positional, err
+}
+
+// 解析checkout與checkout-branch指令的參數
+func parseCheckoutArgs(action string, args []string) (vcs.CheckoutOptions, []string, error) {
+	options := vcs.CheckoutOptions{}
+	flags := flag.NewFlagSet(action, flag.ContinueOnError)
+	flags.BoolVar(&options.Force, "force", false, "discard local changes that would be overwritten")
+	flags.BoolVar(&options.Force, "f", false, "shorthand for --force")
+	flags.BoolVar(&options.Merge, "merge", false, "carry local changes over with a three-way merge")
+	flags.BoolVar(&options.Merge, "m", false, "shorthand for --merge")
+	positional, err := parseFlags(flags, args)
+	return options, positional, err
+}
+
+// 解析gc指令的參數
+func parseGCArgs(args []string) (vcs.GCOptions, []string, error) {
+	options := vcs.GCOptions{}
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	flags.StringVar(&options.Prune, "prune", "", "only prune unreachable data older than this date (default \"2 weeks ago\")")
+	flags.BoolVar(&options.Repack, "repack", false, "pack all objects into a single pack file")
+	positional, err := parseFlags(flags, args)
+	return options, positional, err
+}
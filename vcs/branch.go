@@ -0,0 +1,220 @@
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 列出所有branch名稱
+func (v *VCS) branchNames() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(v.refsDirectory, "heads"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read branches: %v", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// 列出所有branch與其最新版本，目前branch以*標示
+func (v *VCS) ListBranches() error {
+	err1 := v.readCurrentBranch()
+	if err1 != nil {
+		return err1
+	}
+
+	names, err2 := v.branchNames()
+	if err2 != nil {
+		return err2
+	}
+
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	if v.detached() {
+		err4 := v.loadState()
+		if err4 != nil {
+			return err4
+		}
+		fmt.Printf("* (HEAD detached at %s)\n", v.versionLabel())
+	}
+	for _, name := range names {
+		marker := " "
+		if name == v.currentBranch {
+			marker = "*"
+		}
+
+		head, err3 := v.branchHead(name)
+		if err3 != nil {
+			return err3
+		}
+		if head == nil {
+			fmt.Printf("%s %-*s  (no commits yet)\n", marker, width, name)
+			continue
+		}
+		fmt.Printf("%s %-*s  %s (%s) %s\n", marker, width, name, head.label(), shortID(head.id), head.info.Message)
+	}
+	return nil
+}
+
+// 顯示目前branch
+func (v *VCS) ShowCurrentBranch() error {
+	err := v.readCurrentBranch()
+	if err != nil {
+		return err
+	}
+	// 分離HEAD時不在任何branch上，不輸出任何內容
+	if !v.detached() {
+		fmt.Println(v.currentBranch)
+	}
+	return nil
+}
+
+// 刪除branch，只移除branch指標，版本資料夾留待gc清理
+// branch有尚未合併到目前branch的版本時，需要force才能刪除
+func (v *VCS) DeleteBranch(branchName string, force bool) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	err1 := v.loadState()
+	if err1 != nil {
+		return err1
+	}
+
+	err2 := v.checkNoMergeInProgress()
+	if err2 != nil {
+		return err2
+	}
+
+	if !v.branchExists(branchName) {
+		return fmt.Errorf("branch %s does not exist", branchName)
+	}
+	if branchName == v.currentBranch {
+		return fmt.Errorf("cannot delete branch %s while it is checked out", branchName)
+	}
+
+	headID, err3 := v.readBranchHead(branchName)
+	if err3 != nil {
+		return err3
+	}
+
+	// 檢查branch的版本是否都已包含在目前版本中
+	if !force && headID != "" {
+		merged, err5 := v.isAncestor(headID, v.currentCommit)
+		if err5 != nil {
+			return err5
+		}
+		if v.currentCommit == "" || !merged {
+			return fmt.Errorf("branch %s is not fully merged into HEAD; use \"vcs branch -D %s\" to delete it anyway", branchName, branchName)
+		}
+	}
+
+	err6 := os.Remove(v.branchRefPath(branchName))
+	if err6 != nil {
+		return fmt.Errorf("unable to delete branch %s: %v", branchName, err6)
+	}
+	os.Remove(v.branchReflogPath(branchName))
+
+	if headID == "" {
+		fmt.Printf("Deleted branch %s\n", branchName)
+	} else {
+		fmt.Printf("Deleted branch %s (was %s)\n", branchName, shortID(headID))
+	}
+	return nil
+}
+
+// 重新命名branch，新名稱沒有同名的版本資料夾時一併重新命名資料夾
+func (v *VCS) RenameBranch(oldName, newName string) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	err1 := v.loadState()
+	if err1 != nil {
+		return err1
+	}
+
+	err2 := v.checkNoMergeInProgress()
+	if err2 != nil {
+		return err2
+	}
+
+	if !v.branchExists(oldName) {
+		return fmt.Errorf("branch %s does not exist", oldName)
+	}
+	err3 := validateRefName("branch", newName)
+	if err3 != nil {
+		return err3
+	}
+	if v.branchExists(newName) {
+		return fmt.Errorf("branch %s already exists", newName)
+	}
+
+	headID, err4 := v.readBranchHead(oldName)
+	if err4 != nil {
+		return err4
+	}
+	if err10 := os.Rename(v.branchReflogPath(oldName), v.branchReflogPath(newName)); err10 != nil && !os.IsNotExist(err10) {
+		return fmt.Errorf("unable to rename the log of branch %s: %v", oldName, err10)
+	}
+	err5 := v.writeBranchHead(newName, headID)
+	if err5 != nil {
+		return err5
+	}
+	err6 := os.Remove(v.branchRefPath(oldName))
+	if err6 != nil {
+		return fmt.Errorf("unable to remove branch %s: %v", oldName, err6)
+	}
+
+	// 版本的提交編號與所在資料夾無關，重新命名資料夾不影響父版本與tag
+	oldDirectory := filepath.Join(v.historyDirectory, oldName)
+	newDirectory := filepath.Join(v.historyDirectory, newName)
+	if _, err7 := os.Stat(newDirectory); os.IsNotExist(err7) {
+		if err8 := os.Rename(oldDirectory, newDirectory); err8 != nil && !os.IsNotExist(err8) {
+			return fmt.Errorf("unable to rename branch folder: %v", err8)
+		}
+		v.commits = nil
+	}
+
+	if v.currentBranch == oldName {
+		v.currentBranch = newName
+		err9 := v.writeCurrentBranch()
+		if err9 != nil {
+			return err9
+		}
+	}
+
+	fmt.Printf("Renamed branch %s to %s\n", oldName, newName)
+	return nil
+}
+
+// 重新命名目前branch
+func (v *VCS) RenameCurrentBranch(newName string) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	err := v.readCurrentBranch()
+	if err != nil {
+		return err
+	}
+	if v.detached() {
+		return fmt.Errorf("HEAD is detached; specify the branch to rename")
+	}
+	return v.RenameBranch(v.currentBranch, newName)
+}
@@ -0,0 +1,261 @@
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 簽出版本時如何處理會被覆蓋的本地修改
+type CheckoutOptions struct {
+	Force bool // 捨棄本地修改，以目標版本的內容覆蓋暫存區與工作區
+	Merge bool // 以三方合併將本地修改帶到目標版本，無法合併的部分寫入衝突標記
+}
+
+// 切換版本的計畫：切換前的三個狀態、目標版本的清單，以及切換會覆蓋本地修改的路徑
+type switchPlan struct {
+	label   string // 目標版本的顯示名稱，用於衝突標記
+	options CheckoutOptions
+	head    manifest // 目前版本
+	staged  manifest // 暫存區
+	working manifest // 工作區
+	target  manifest // 目標版本
+	blocked map[string]bool
+}
+
+// 檢查簽出選項
+func (options CheckoutOptions) validate() error {
+	if options.Force && options.Merge {
+		return fmt.Errorf("--force and --merge cannot be used together")
+	}
+	return nil
+}
+
+// 比較兩份清單中路徑的狀態，兩邊都不存在也視為相同
+func sameEntry(a, b manifest, path string) bool {
+	hashA, inA := a[path]
+	hashB, inB := b[path]
+	return inA == inB && hashA == hashB
+}
+
+// 規劃切換到目標清單，找出有本地修改且切換會改變的路徑
+// 本地修改包含暫存區與工作區中已追蹤檔案的變更，以及會被目標版本覆蓋的未追蹤檔案
+// 沒有指定Force或Merge時，若有會被覆蓋的檔案則列出並停止
+func (v *VCS) planSwitch(target manifest, label string, options CheckoutOptions) (*switchPlan, error) {
+	err1 := options.validate()
+	if err1 != nil {
+		return nil, err1
+	}
+
+	plan := &switchPlan{label: label, options: options, target: target, blocked: map[string]bool{}}
+	var err2, err3, err4 error
+	if plan.head, err2 = v.currentManifest(); err2 != nil {
+		return nil, err2
+	}
+	if plan.staged, err3 = v.stagedManifest(); err3 != nil {
+		return nil, err3
+	}
+	if plan.working, err4 = v.workingManifest(plan.head, plan.staged); err4 != nil {
+		return nil, err4
+	}
+
+	for path := range plan.working {
+		_, inHead := plan.head[path]
+		_, inStaged := plan.staged[path]
+		_, inTarget := target[path]
+		if !inHead && !inStaged && inTarget && !sameEntry(plan.working, target, path) {
+			plan.blocked[path] = true
+		}
+	}
+	for _, path := range plan.trackedPaths() {
+		if !plan.changed(path) || sameEntry(plan.head, target, path) {
+			continue
+		}
+		// 本地修改後的內容已與目標版本相同，切換不會遺失任何內容
+		if sameEntry(plan.staged, target, path) && sameEntry(plan.working, target, path) {
+			continue
+		}
+		plan.blocked[path] = true
+	}
+
+	if len(plan.blocked) > 0 && !options.Force && !options.Merge {
+		blocked := []string{}
+		for path := range plan.blocked {
+			blocked = append(blocked, path)
+		}
+		sort.Strings(blocked)
+		return nil, fmt.Errorf("your local changes to the following files would be overwritten by checkout:\n\t%s\ncommit your changes, or use --force to discard them or --merge to carry them over", strings.Join(blocked, "\n\t"))
+	}
+	return plan, nil
+}
+
+// 目前版本、暫存區與目標版本中出現的所有路徑，會被覆蓋的未追蹤檔案也包含在目標版本中
+func (plan *switchPlan) trackedPaths() []string {
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, m := range []manifest{plan.head, plan.staged, plan.target} {
+		for path := range m {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// 路徑是否有本地修改：暫存區與目前版本不同，或工作區與暫存區不同
+func (plan *switchPlan) changed(path string) bool {
+	_, inStaged := plan.staged[path]
+	return !sameEntry(plan.head, plan.staged, path) || (inStaged && !sameEntry(plan.staged, plan.working, path))
+}
+
+// 依計畫將目標版本寫入暫存區與工作區
+// 切換不會改變的路徑保留本地修改；Force時捨棄所有本地修改，Merge時合併會被覆蓋的本地修改
+func (v *VCS) applySwitch(plan *switchPlan) error {
+	for _, path := range plan.trackedPaths() {
+		_, inHead := plan.head[path]
+		_, inTarget := plan.target[path]
+		switch {
+		case !plan.options.Force && plan.changed(path) && !plan.blocked[path]:
+			// 切換不會改變此路徑，保留本地修改
+			continue
+		case plan.blocked[path] && plan.options.Merge:
+			err1 := v.mergeLocalChanges(plan, path)
+			if err1 != nil {
+				return err1
+			}
+		case inTarget:
+			data, err2 := v.readObject(plan.target[path])
+			if err2 != nil {
+				return err2
+			}
+			err3 := writeFileWithParents(v.workingPath(path), data)
+			if err3 != nil {
+				return fmt.Errorf("unable to switch workspace version for %s: %v", path, err3)
+			}
+			err4 := writeStagedFile(v.stagedPath(path), data)
+			if err4 != nil {
+				return fmt.Errorf("unable to switch the staging area version for %s: %v", path, err4)
+			}
+		default:
+			// 目標版本沒有此檔案：移出暫存區，原本追蹤的檔案也從工作區刪除
+			err5 := v.removeSwitchedFile(path, inHead)
+			if err5 != nil {
+				return err5
+			}
+		}
+	}
+	return nil
+}
+
+// 將檔案移出暫存區，removeWorking為true時也從工作區刪除
+func (v *VCS) removeSwitchedFile(path string, removeWorking bool) error {
+	err1 := os.Remove(v.stagedPath(path))
+	if err1 != nil && !os.IsNotExist(err1) {
+		return fmt.Errorf("unable to remove %s from the staging area: %v", path, err1)
+	}
+	removeEmptyParents(filepath.Dir(v.stagedPath(path)), v.filesDirectory)
+
+	if removeWorking {
+		err2 := os.Remove(v.workingPath(path))
+		if err2 != nil && !os.IsNotExist(err2) {
+			return fmt.Errorf("unable to remove %s: %v", path, err2)
+		}
+		removeEmptyParents(filepath.Dir(v.workingPath(path)), v.workingDirectory)
+	}
+	return nil
+}
+
+// 以目前版本為基底，合併工作區的本地修改與目標版本的內容
+// 暫存區寫入目標版本的內容，合併結果寫入工作區，因此本地修改會顯示為尚未暫存的變更
+func (v *VCS) mergeLocalChanges(plan *switchPlan, path string) error {
+	// 目標版本沒有此檔案時，保留工作區的檔案為未追蹤檔案
+	if _, inTarget := plan.target[path]; !inTarget {
+		fmt.Printf("Kept local changes to %s, which does not exist in %s\n", path, plan.label)
+		return v.removeSwitchedFile(path, false)
+	}
+
+	theirs, err1 := v.readObject(plan.target[path])
+	if err1 != nil {
+		return err1
+	}
+	base := []byte{}
+	if hash, inHead := plan.head[path]; inHead {
+		var err2 error
+		if base, err2 = v.readObject(hash); err2 != nil {
+			return err2
+		}
+	}
+	ours := []byte{}
+	if _, inWorking := plan.working[path]; inWorking {
+		var err3 error
+		if ours, err3 = os.ReadFile(v.workingPath(path)); err3 != nil {
+			return fmt.Errorf("unable to read %s: %v", path, err3)
+		}
+	}
+
+	err4 := writeStagedFile(v.stagedPath(path), theirs)
+	if err4 != nil {
+		return fmt.Errorf("unable to switch the staging area version for %s: %v", path, err4)
+	}
+
+	// 二進位檔無法逐行合併，保留工作區的本地版本
+	if isBinary(base) || isBinary(ours) || isBinary(theirs) {
+		fmt.Printf("CONFLICT (binary): kept local version of %s\n", path)
+		return nil
+	}
+
+	merged, conflicts := merge3(splitLines(base), splitLines(ours), splitLines(theirs), "local", plan.label, MergeRecursive)
+	err5 := writeFileWithParents(v.workingPath(path), []byte(strings.Join(merged, "")))
+	if err5 != nil {
+		return fmt.Errorf("unable to write %s: %v", path, err5)
+	}
+	if conflicts > 0 {
+		fmt.Printf("CONFLICT (content): merge conflict in %s\n", path)
+	} else {
+		fmt.Printf("Merged local changes to %s\n", path)
+	}
+	return nil
+}
+
+// 規劃簽出指定版本，record為nil時目標為空的版本
+func (v *VCS) planCheckout(record *commitRecord, options CheckoutOptions) (*switchPlan, error) {
+	target, err1 := v.recordManifest(record)
+	if err1 != nil {
+		return nil, err1
+	}
+	label := "empty"
+	if record != nil {
+		label = record.label()
+	}
+	return v.planSwitch(target, label, options)
+}
+
+// 依計畫寫入暫存區與工作區，並將目前版本設為record
+func (v *VCS) completeCheckout(plan *switchPlan, record *commitRecord) error {
+	err1 := v.applySwitch(plan)
+	if err1 != nil {
+		return err1
+	}
+
+	v.currentCommit = ""
+	v.currentVersion = 0
+	if record != nil {
+		v.currentCommit = record.id
+		v.currentVersion = record.version
+	}
+	return v.writeCurrentCommit()
+}
+
+// 簽出版本，有會被覆蓋的本地修改時停止
+func (v *VCS) checkoutCommit(record *commitRecord) error {
+	plan, err1 := v.planCheckout(record, CheckoutOptions{})
+	if err1 != nil {
+		return err1
+	}
+	return v.completeCheckout(plan, record)
+}
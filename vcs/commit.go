@@ -0,0 +1,109 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// 提交資訊的檔名
+const commitFileName = "commit.json"
+
+// 提交者
+type commitAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// 每個版本的提交資訊，以JSON儲存在版本資料夾中
+// 提交編號為commit.json內容的SHA-256雜湊值
+type commitInfo struct {
+	Message   string       `json:"message"`
+	Author    commitAuthor `json:"author"`
+	Timestamp time.Time    `json:"timestamp"`
+	Parents   []string     `json:"parents"`  // 父版本的提交編號
+	Branch    string       `json:"branch"`   // 提交時所在的branch
+	Version   int          `json:"version"`  // 在branch中的版本編號
+	Manifest  string       `json:"manifest"` // manifest.json的雜湊值
+}
+
+// 取得提交者，優先使用VCS_AUTHOR_NAME與VCS_AUTHOR_EMAIL環境變數，否則使用系統帳號名稱
+func currentAuthor() commitAuthor {
+	author := commitAuthor{Name: os.Getenv("VCS_AUTHOR_NAME"), Email: os.Getenv("VCS_AUTHOR_EMAIL")}
+	if author.Name == "" {
+		if systemUser, err := user.Current(); err == nil {
+			author.Name = systemUser.Username
+		}
+	}
+	if author.Name == "" {
+		author.Name = "unknown"
+	}
+	return author
+}
+
+// 顯示用的提交者，例如Name <email>
+func formatAuthor(author commitAuthor) string {
+	if author.Email == "" {
+		return author.Name
+	}
+	return fmt.Sprintf("%s <%s>", author.Name, author.Email)
+}
+
+// 將提交資訊寫入版本資料夾，回傳提交編號
+func writeCommitInfo(versionDirectory string, info commitInfo) (string, error) {
+	data, err1 := json.MarshalIndent(info, "", "  ")
+	if err1 != nil {
+		return "", fmt.Errorf("unable to encode commit information: %v", err1)
+	}
+
+	err2 := os.WriteFile(filepath.Join(versionDirectory, commitFileName), data, 0644)
+	if err2 != nil {
+		return "", fmt.Errorf("failed to write commit information: %v", err2)
+	}
+	return hashBytes(data), nil
+}
+
+// 從版本資料夾讀取提交資訊與提交編號
+func readCommitInfo(versionDirectory string) (commitInfo, string, error) {
+	info := commitInfo{}
+	data, err1 := os.ReadFile(filepath.Join(versionDirectory, commitFileName))
+	if err1 != nil {
+		return info, "", fmt.Errorf("unable to read commit information: %v", err1)
+	}
+
+	err2 := json.Unmarshal(data, &info)
+	if err2 != nil {
+		return info, "", fmt.Errorf("unable to decode commit information: %v", err2)
+	}
+	return info, hashBytes(data), nil
+}
+
+// 在版本資料夾中寫入版本清單與提交資訊，回傳提交編號
+func (v *VCS) writeVersion(versionDirectory, branch string, version int, m manifest, message string, parents []string) (string, error) {
+	manifestHash, err1 := writeManifest(versionDirectory, m)
+	if err1 != nil {
+		return "", err1
+	}
+
+	// 版本內容改變，清除已讀取的版本
+	v.commits = nil
+
+	info := commitInfo{
+		Message:   message,
+		Author:    currentAuthor(),
+		Timestamp: time.Now(),
+		Parents:   parents,
+		Branch:    branch,
+		Version:   version,
+		Manifest:  manifestHash,
+	}
+	return writeCommitInfo(versionDirectory, info)
+}
+
+// 提交編號的縮寫
+func shortID(id string) string {
+	return id[:min(len(id), 10)]
+}
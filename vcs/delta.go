@@ -0,0 +1,123 @@
+package vcs
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 比對區塊大小，基底內容以此長度切塊建立索引
+const deltaBlockSize = 16
+
+// 差異指令
+const (
+	deltaCopy   byte = 1 // 從基底複製一段內容
+	deltaInsert byte = 2 // 插入新的內容
+)
+
+// 產生將base轉換成target的差異資料，文字與二進位檔案皆適用
+// 格式：基底長度、目標長度，接著一連串的複製或插入指令
+func makeDelta(base, target []byte) []byte {
+	delta := binary.AppendUvarint(nil, uint64(len(base)))
+	delta = binary.AppendUvarint(delta, uint64(len(target)))
+
+	// 將基底切成固定大小的區塊，記錄每個區塊第一次出現的位置
+	index := make(map[string]int)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		block := string(base[i : i+deltaBlockSize])
+		if _, exists := index[block]; !exists {
+			index[block] = i
+		}
+	}
+
+	insertStart := 0
+	position := 0
+	for position+deltaBlockSize <= len(target) {
+		offset, found := index[string(target[position:position+deltaBlockSize])]
+		if !found {
+			position++
+			continue
+		}
+
+		// 向前與向後延伸相同的部分
+		start, baseStart := position, offset
+		for start > insertStart && baseStart > 0 && target[start-1] == base[baseStart-1] {
+			start--
+			baseStart--
+		}
+		end, baseEnd := position+deltaBlockSize, offset+deltaBlockSize
+		for end < len(target) && baseEnd < len(base) && target[end] == base[baseEnd] {
+			end++
+			baseEnd++
+		}
+
+		delta = appendDeltaInsert(delta, target[insertStart:start])
+		delta = append(delta, deltaCopy)
+		delta = binary.AppendUvarint(delta, uint64(baseStart))
+		delta = binary.AppendUvarint(delta, uint64(end-start))
+
+		position = end
+		insertStart = end
+	}
+	return appendDeltaInsert(delta, target[insertStart:])
+}
+
+// 加入插入指令
+func appendDeltaInsert(delta, data []byte) []byte {
+	if len(data) == 0 {
+		return delta
+	}
+	delta = append(delta, deltaInsert)
+	delta = binary.AppendUvarint(delta, uint64(len(data)))
+	return append(delta, data...)
+}
+
+// 依差異資料從base還原出目標內容
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseLength, n1 := binary.Uvarint(delta)
+	if n1 <= 0 || baseLength != uint64(len(base)) {
+		return nil, fmt.Errorf("delta does not match its base")
+	}
+	delta = delta[n1:]
+
+	targetLength, n2 := binary.Uvarint(delta)
+	if n2 <= 0 {
+		return nil, fmt.Errorf("corrupt delta header")
+	}
+	delta = delta[n2:]
+
+	// 目標長度來自物件檔案，損壞時可能大得不合理，預先配置的空間不超過基底與差異資料的長度，不足時再擴充
+	target := make([]byte, 0, min(targetLength, uint64(len(base)+len(delta))))
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch op {
+		case deltaCopy:
+			offset, n3 := binary.Uvarint(delta)
+			if n3 <= 0 {
+				return nil, fmt.Errorf("corrupt delta copy instruction")
+			}
+			delta = delta[n3:]
+			length, n4 := binary.Uvarint(delta)
+			if n4 <= 0 || offset > uint64(len(base)) || length > uint64(len(base))-offset {
+				return nil, fmt.Errorf("corrupt delta copy instruction")
+			}
+			delta = delta[n4:]
+			target = append(target, base[offset:offset+length]...)
+		case deltaInsert:
+			length, n5 := binary.Uvarint(delta)
+			if n5 <= 0 || length > uint64(len(delta)-n5) {
+				return nil, fmt.Errorf("corrupt delta insert instruction")
+			}
+			delta = delta[n5:]
+			target = append(target, delta[:length]...)
+			delta = delta[length:]
+		default:
+			return nil, fmt.Errorf("unknown delta instruction %d", op)
+		}
+	}
+
+	if uint64(len(target)) != targetLength {
+		return nil, fmt.Errorf("delta produced %d bytes, expected %d", len(target), targetLength)
+	}
+	return target, nil
+}
@@ -0,0 +1,88 @@
+package vcs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	noise := make([]byte, 4096)
+	random.Read(noise)
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 50)
+
+	tests := []struct {
+		name         string
+		base, target []byte
+	}{
+		{"both empty", nil, nil},
+		{"empty base", nil, []byte("new file\n")},
+		{"empty target", []byte(text), nil},
+		{"identical", []byte(text), []byte(text)},
+		{"shorter than a block", []byte("abc"), []byte("abd")},
+		{"insert in the middle", []byte(text), []byte(text[:500] + "inserted line\n" + text[500:])},
+		{"delete from the middle", []byte(text), []byte(text[:300] + text[900:])},
+		{"append and prepend", []byte(text), []byte("header\n" + text + "footer\n")},
+		{"repeated base blocks", []byte(text[:64]), []byte(strings.Repeat(text[:64], 10))},
+		{"binary change", noise, append(append(append([]byte{}, noise[:1000]...), 0, 1, 2, 3), noise[1000:]...)},
+		{"unrelated content", noise[:2048], noise[2048:]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delta := makeDelta(test.base, test.target)
+			got, err := applyDelta(test.base, delta)
+			if err != nil {
+				t.Fatalf("applyDelta: %v", err)
+			}
+			if !bytes.Equal(got, test.target) {
+				t.Fatalf("applyDelta returned %q, want %q", got, test.target)
+			}
+		})
+	}
+}
+
+func TestDeltaCopiesSharedContent(t *testing.T) {
+	base := []byte(strings.Repeat("0123456789abcdef", 256))
+	target := append(append([]byte{}, base...), "tail"...)
+	if delta := makeDelta(base, target); len(delta) > 64 {
+		t.Fatalf("delta for an appended tail is %d bytes, expected it to copy the base", len(delta))
+	}
+}
+
+func TestApplyCorruptDelta(t *testing.T) {
+	base := []byte("0123456789abcdef0123456789abcdef")
+	header := func(baseLength, targetLength uint64) []byte {
+		delta := binary.AppendUvarint(nil, baseLength)
+		return binary.AppendUvarint(delta, targetLength)
+	}
+	copyInstruction := func(offset, length uint64) []byte {
+		instruction := binary.AppendUvarint([]byte{deltaCopy}, offset)
+		return binary.AppendUvarint(instruction, length)
+	}
+
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"empty", nil},
+		{"wrong base length", header(5, 0)},
+		{"missing target length", binary.AppendUvarint(nil, uint64(len(base)))},
+		{"huge target length", append(header(uint64(len(base)), math.MaxUint64), copyInstruction(0, 4)...)},
+		{"target length too long", append(header(uint64(len(base)), 10), copyInstruction(0, 4)...)},
+		{"copy past the base", append(header(uint64(len(base)), 8), copyInstruction(30, 8)...)},
+		{"copy offset overflow", append(header(uint64(len(base)), 8), copyInstruction(math.MaxUint64, 2)...)},
+		{"truncated insert", append(header(uint64(len(base)), 8), deltaInsert, 8, 'a', 'b')},
+		{"unknown instruction", append(header(uint64(len(base)), 0), 9)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := applyDelta(base, test.delta); err == nil {
+				t.Fatalf("applyDelta returned %q, want an error", got)
+			}
+		})
+	}
+}
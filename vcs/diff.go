@@ -0,0 +1,448 @@
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 差異輸出時前後保留的相同行數
+const diffContextLines = 3
+
+// 判斷是否為二進位檔時檢查的前置位元組數
+const binarySniffLength = 8000
+
+// 差異中的一行，kind為' '（相同）、'-'（刪除）或'+'（新增）
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// 比較的其中一邊：檔案清單與讀取內容的方式
+type diffSide struct {
+	files manifest
+	read  func(path string) ([]byte, error)
+}
+
+// 判斷內容是否為二進位檔
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniffLength)], 0) >= 0
+}
+
+// 將內容切成行，每行保留結尾的換行字元
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// 以Myers演算法計算兩組行之間的最短編輯序列
+func diffLines(a, b []string) []diffLine {
+	// 先去掉相同的開頭與結尾，縮小需要比對的範圍
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	lines = append(lines, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	return lines
+}
+
+// Myers差異演算法，記錄每一輪的最遠位置再回溯出編輯序列
+func myersDiff(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	maxEdits := n + m
+	offset := maxEdits + 1
+	frontier := make([]int, 2*maxEdits+3)
+
+	// trace[d]保存第d輪開始前，對角線-d-1到d+1的最遠位置
+	trace := [][]int{}
+	for d := 0; d <= maxEdits; d++ {
+		trace = append(trace, append([]int(nil), frontier[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && frontier[offset+k-1] < frontier[offset+k+1]) {
+				x = frontier[offset+k+1]
+			} else {
+				x = frontier[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			frontier[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(trace, a, b)
+			}
+		}
+	}
+	return nil
+}
+
+// 從終點沿著trace回溯，產生編輯序列
+func backtrackDiff(trace [][]int, a, b []string) []diffLine {
+	lines := []diffLine{}
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		// trace[d]的索引0對應對角線-d-1
+		furthest := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+
+		var previousK int
+		if k == -d || (k != d && furthest(k-1) < furthest(k+1)) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+		previousX := furthest(previousK)
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			lines = append(lines, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == previousX {
+				lines = append(lines, diffLine{'+', b[y-1]})
+				y--
+			} else {
+				lines = append(lines, diffLine{'-', a[x-1]})
+				x--
+			}
+		}
+	}
+
+	// 回溯的結果是倒序的
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// 產生unified格式的差異內容，沒有差異時回傳空字串
+func unifiedDiff(oldName, newName string, oldData, newData []byte) string {
+	lines := diffLines(splitLines(oldData), splitLines(newData))
+
+	// 找出有變更的行
+	changes := []int{}
+	for i, line := range lines {
+		if line.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "--- %s\n+++ %s\n", oldName, newName)
+
+	// 記錄每一行之前已經過的舊檔與新檔行數
+	oldBefore := make([]int, len(lines)+1)
+	newBefore := make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldBefore[i+1] = oldBefore[i]
+		newBefore[i+1] = newBefore[i]
+		if line.kind != '+' {
+			oldBefore[i+1]++
+		}
+		if line.kind != '-' {
+			newBefore[i+1]++
+		}
+	}
+
+	// 距離相近的變更合併成同一個區塊
+	for i := 0; i < len(changes); {
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContextLines {
+			j++
+		}
+		start := max(changes[i]-diffContextLines, 0)
+		end := min(changes[j]+diffContextLines+1, len(lines))
+
+		oldCount := oldBefore[end] - oldBefore[start]
+		newCount := newBefore[end] - newBefore[start]
+		fmt.Fprintf(&builder, "@@ -%s +%s @@\n", hunkRange(oldBefore[start], oldCount), hunkRange(newBefore[start], newCount))
+		for _, line := range lines[start:end] {
+			builder.WriteByte(line.kind)
+			builder.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = j + 1
+	}
+	return builder.String()
+}
+
+// 區塊標頭中的行號範圍，空範圍以前一行表示
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// 統計中單一檔案的行數變化
+type diffStatEntry struct {
+	path       string
+	insertions int
+	deletions  int
+	binary     bool
+}
+
+// diffstat長條圖的最大寬度
+const diffStatWidth = 50
+
+// 計算兩個內容之間新增與刪除的行數
+func diffStat(oldData, newData []byte) (int, int) {
+	insertions, deletions := 0, 0
+	for _, line := range diffLines(splitLines(oldData), splitLines(newData)) {
+		switch line.kind {
+		case '+':
+			insertions++
+		case '-':
+			deletions++
+		}
+	}
+	return insertions, deletions
+}
+
+// 產生diffstat格式的統計：每個檔案的行數變化長條圖與總計
+func formatDiffStat(entries []diffStatEntry) string {
+	nameWidth, maxChanges := 0, 0
+	totalInsertions, totalDeletions := 0, 0
+	for _, entry := range entries {
+		nameWidth = max(nameWidth, len(entry.path))
+		maxChanges = max(maxChanges, entry.insertions+entry.deletions)
+		totalInsertions += entry.insertions
+		totalDeletions += entry.deletions
+	}
+	countWidth := len(fmt.Sprint(maxChanges))
+
+	var builder strings.Builder
+	for _, entry := range entries {
+		if entry.binary {
+			fmt.Fprintf(&builder, " %-*s | Bin\n", nameWidth, entry.path)
+			continue
+		}
+
+		// 變化行數超過長條圖寬度時依比例縮小
+		insertions, deletions := entry.insertions, entry.deletions
+		if maxChanges > diffStatWidth {
+			insertions = (insertions*diffStatWidth + maxChanges - 1) / maxChanges
+			deletions = (deletions*diffStatWidth + maxChanges - 1) / maxChanges
+		}
+		fmt.Fprintf(&builder, " %-*s | %*d %s%s\n", nameWidth, entry.path, countWidth, entry.insertions+entry.deletions,
+			strings.Repeat("+", insertions), strings.Repeat("-", deletions))
+	}
+
+	fmt.Fprintf(&builder, " %d %s changed, %d %s(+), %d %s(-)\n", len(entries), plural(len(entries), "file", "files"),
+		totalInsertions, plural(totalInsertions, "insertion", "insertions"), totalDeletions, plural(totalDeletions, "deletion", "deletions"))
+	return builder.String()
+}
+
+// 依數量選擇單數或複數形式
+func plural(count int, singular, pluralForm string) string {
+	if count == 1 {
+		return singular
+	}
+	return pluralForm
+}
+
+// 比較兩邊所有檔案，輸出有差異的部分
+func writeTreeDiff(builder *strings.Builder, from, to diffSide) error {
+	paths := manifest{}
+	for path := range from.files {
+		paths[path] = ""
+	}
+	for path := range to.files {
+		paths[path] = ""
+	}
+
+	for _, path := range paths.paths() {
+		fromHash, inFrom := from.files[path]
+		toHash, inTo := to.files[path]
+		if inFrom && inTo && fromHash == toHash {
+			continue
+		}
+
+		oldName, newName := "a/"+path, "b/"+path
+		var oldData, newData []byte
+		if inFrom {
+			data, err := from.read(path)
+			if err != nil {
+				return err
+			}
+			oldData = data
+		} else {
+			oldName = "/dev/null"
+		}
+		if inTo {
+			data, err := to.read(path)
+			if err != nil {
+				return err
+			}
+			newData = data
+		} else {
+			newName = "/dev/null"
+		}
+
+		fmt.Fprintf(builder, "diff --vcs a/%s b/%s\n", path, path)
+		switch {
+		case !inFrom:
+			builder.WriteString("new file\n")
+		case !inTo:
+			builder.WriteString("deleted file\n")
+		}
+		if isBinary(oldData) || isBinary(newData) {
+			fmt.Fprintf(builder, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		builder.WriteString(unifiedDiff(oldName, newName, oldData, newData))
+	}
+	return nil
+}
+
+// 暫存區作為比較的一邊
+func (v *VCS) stagedDiffSide() (diffSide, error) {
+	files, err := v.stagedManifest()
+	if err != nil {
+		return diffSide{}, err
+	}
+	read := func(path string) ([]byte, error) {
+		return readStagedFile(v.stagedPath(path))
+	}
+	return diffSide{files: files, read: read}, nil
+}
+
+// 工作區作為比較的一邊，只包含tracked中出現的檔案
+func (v *VCS) workingDiffSide(tracked manifest) (diffSide, error) {
+	files := manifest{}
+	for path := range tracked {
+		data, err := os.ReadFile(v.workingPath(path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return diffSide{}, fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		files[path] = hashBytes(data)
+	}
+	read := func(path string) ([]byte, error) {
+		data, err := os.ReadFile(v.workingPath(path))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		return data, nil
+	}
+	return diffSide{files: files, read: read}, nil
+}
+
+// 指定版本作為比較的一邊
+func (v *VCS) versionDiffSide(revision string) (diffSide, error) {
+	record, err1 := v.resolveRevision(revision)
+	if err1 != nil {
+		return diffSide{}, err1
+	}
+	files, err2 := readManifest(record.directory)
+	if err2 != nil {
+		return diffSide{}, fmt.Errorf("version %s does not exist: %v", record.label(), err2)
+	}
+	return v.manifestDiffSide(files), nil
+}
+
+// 版本清單作為比較的一邊，內容從物件庫讀取
+func (v *VCS) manifestDiffSide(files manifest) diffSide {
+	read := func(path string) ([]byte, error) {
+		return v.readObject(files[path])
+	}
+	return diffSide{files: files, read: read}
+}
+
+// 顯示差異
+// 沒有指定版本時比較暫存區與工作區；staged為true時比較目前版本與暫存區；
+// 指定一個版本時比較該版本與工作區；指定兩個版本時比較這兩個版本，版本可寫成<branch>@<version>跨分支比較
+func (v *VCS) Diff(staged bool, revisions ...string) error {
+	// 從檔案讀取currentBranch與目前版本
+	err1 := v.loadState()
+	if err1 != nil {
+		return err1
+	}
+
+	var from, to diffSide
+	var err2 error
+	switch {
+	case len(revisions) > 2:
+		return fmt.Errorf("at most two versions can be compared")
+	case len(revisions) == 2:
+		if from, err2 = v.versionDiffSide(revisions[0]); err2 != nil {
+			return err2
+		}
+		if to, err2 = v.versionDiffSide(revisions[1]); err2 != nil {
+			return err2
+		}
+	case len(revisions) == 1 && staged:
+		if from, err2 = v.versionDiffSide(revisions[0]); err2 != nil {
+			return err2
+		}
+		if to, err2 = v.stagedDiffSide(); err2 != nil {
+			return err2
+		}
+	case len(revisions) == 1:
+		if from, err2 = v.versionDiffSide(revisions[0]); err2 != nil {
+			return err2
+		}
+		if to, err2 = v.workingDiffSide(from.files); err2 != nil {
+			return err2
+		}
+	case staged:
+		// 尚未提交過則與空版本比較
+		from = v.manifestDiffSide(manifest{})
+		if v.currentCommit != "" {
+			if from, err2 = v.versionDiffSide("HEAD"); err2 != nil {
+				return err2
+			}
+		}
+		if to, err2 = v.stagedDiffSide(); err2 != nil {
+			return err2
+		}
+	default:
+		if from, err2 = v.stagedDiffSide(); err2 != nil {
+			return err2
+		}
+		if to, err2 = v.workingDiffSide(from.files); err2 != nil {
+			return err2
+		}
+	}
+
+	var builder strings.Builder
+	err4 := writeTreeDiff(&builder, from, to)
+	if err4 != nil {
+		return err4
+	}
+	fmt.Print(builder.String())
+	return nil
+}
@@ -0,0 +1,115 @@
+package vcs
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// 依差異還原兩邊的內容，並計算新增與刪除的行數
+func replayDiff(lines []diffLine) (before, after []string, edits int) {
+	for _, line := range lines {
+		switch line.kind {
+		case ' ':
+			before = append(before, line.text)
+			after = append(after, line.text)
+		case '-':
+			before = append(before, line.text)
+			edits++
+		case '+':
+			after = append(after, line.text)
+			edits++
+		}
+	}
+	return before, after, edits
+}
+
+// 以最長共同子序列計算最短編輯距離
+func editDistance(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return len(a) + len(b) - 2*lcs[0][0]
+}
+
+func TestMyersDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		distance int
+	}{
+		{"both empty", "", "", 0},
+		{"identical", "abc", "abc", 0},
+		{"insert everything", "", "abc", 3},
+		{"delete everything", "abc", "", 3},
+		{"replace one", "abc", "axc", 2},
+		{"myers paper example", "abcabba", "cbabac", 5},
+		{"insert in the middle", "abde", "abcde", 1},
+		{"moved line", "abcd", "bcda", 2},
+		{"nothing in common", "abc", "xyz", 6},
+		{"repeated lines", "aaaa", "aa", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := strings.Split(test.a, ""), strings.Split(test.b, "")
+			if test.a == "" {
+				a = nil
+			}
+			if test.b == "" {
+				b = nil
+			}
+			for name, diff := range map[string]func(a, b []string) []diffLine{"myersDiff": myersDiff, "diffLines": diffLines} {
+				before, after, edits := replayDiff(diff(a, b))
+				if strings.Join(before, "") != test.a || strings.Join(after, "") != test.b {
+					t.Fatalf("%s replays to %q -> %q, want %q -> %q", name, strings.Join(before, ""), strings.Join(after, ""), test.a, test.b)
+				}
+				if edits != test.distance {
+					t.Fatalf("%s made %d edits, want %d", name, edits, test.distance)
+				}
+			}
+		})
+	}
+}
+
+func TestMyersDiffIsMinimal(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		before, after, edits := replayDiff(diffLines(a, b))
+		if !sameLines(before, a) || !sameLines(after, b) {
+			t.Fatalf("diff of %q and %q does not replay to its inputs", a, b)
+		}
+		if want := editDistance(a, b); edits != want {
+			t.Fatalf("diff of %q and %q made %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldData := []byte("one\ntwo\nthree\n")
+	newData := []byte("one\n2\nthree\nfour\n")
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,4 @@\n one\n-two\n+2\n three\n+four\n"
+	if got := unifiedDiff("a/f.txt", "b/f.txt", oldData, newData); got != want {
+		t.Fatalf("unifiedDiff returned\n%s\nwant\n%s", got, want)
+	}
+	if got := unifiedDiff("a/f.txt", "b/f.txt", oldData, oldData); got != "" {
+		t.Fatalf("unifiedDiff of identical content returned %q, want an empty diff", got)
+	}
+}
@@ -0,0 +1,361 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 完整性檢查的結束代碼
+const (
+	FsckOK       = 0 // 沒有發現問題
+	FsckWarnings = 1 // 只有不影響使用的問題，例如版本編號不連續
+	FsckErrors   = 2 // 有損壞的資料，例如缺少提交資訊或內容與雜湊值不符
+)
+
+// 完整性檢查的結果
+type fsckReport struct {
+	errors   int
+	warnings int
+}
+
+// 回報損壞的資料
+func (report *fsckReport) errorf(format string, args ...any) {
+	report.errors++
+	fmt.Printf("error: "+format+"\n", args...)
+}
+
+// 回報不影響使用的問題
+func (report *fsckReport) warnf(format string, args ...any) {
+	report.warnings++
+	fmt.Printf("warning: "+format+"\n", args...)
+}
+
+// 依檢查結果回傳結束代碼
+func (report *fsckReport) exitCode() int {
+	switch {
+	case report.errors > 0:
+		return FsckErrors
+	case report.warnings > 0:
+		return FsckWarnings
+	}
+	return FsckOK
+}
+
+// 檢查.vcs的完整性，列出每個問題並回傳結束代碼（FsckOK、FsckWarnings或FsckErrors）
+// 檢查項目：版本資料夾缺少或無法解析的提交資訊與版本清單、版本編號的缺口、無法讀取的檔案、
+// 物件內容與雜湊值不符、指向不存在版本的branch與tag，以及目前branch與目前版本的指標
+func (v *VCS) Verify() (int, error) {
+	if _, err := os.Stat(v.repoDirectory); os.IsNotExist(err) {
+		return FsckErrors, fmt.Errorf("not a vcs repository (run \"vcs init\" first)")
+	}
+
+	report := &fsckReport{}
+	commits := v.verifyHistory(report)
+
+	// 之後的檢查以讀取成功的版本為準，才能沿著父版本走訪
+	v.commits = commits
+	v.verifyVersionNumbers(report, commits)
+	v.verifyObjects(report)
+	v.verifyRefs(report, commits)
+	v.verifyPointers(report, commits)
+	v.verifyStagingArea(report)
+
+	if report.errors == 0 && report.warnings == 0 {
+		fmt.Printf("Checked %d versions, no problems found\n", len(commits))
+	} else {
+		fmt.Printf("Checked %d versions: %d %s, %d %s\n", len(commits), report.errors, plural(report.errors, "error", "errors"), report.warnings, plural(report.warnings, "warning", "warnings"))
+	}
+	return report.exitCode(), nil
+}
+
+// 檢查history中每個版本資料夾的提交資訊與版本清單，回傳可以讀取的版本
+func (v *VCS) verifyHistory(report *fsckReport) map[string]*commitRecord {
+	commits := map[string]*commitRecord{}
+	branchFolders, err1 := os.ReadDir(v.historyDirectory)
+	if err1 != nil {
+		report.errorf("unable to read history folder: %v", err1)
+		return commits
+	}
+
+	for _, branchFolder := range branchFolders {
+		if !branchFolder.IsDir() {
+			continue
+		}
+		branchDirectory := filepath.Join(v.historyDirectory, branchFolder.Name())
+		versionFolders, err2 := os.ReadDir(branchDirectory)
+		if err2 != nil {
+			report.errorf("unable to read history folder %s: %v", branchFolder.Name(), err2)
+			continue
+		}
+
+		for _, versionFolder := range versionFolders {
+			name := versionFolder.Name()
+			if strings.HasPrefix(name, temporaryPrefix+"version_") {
+				report.warnf("incomplete version folder %s/%s left by an interrupted commit", branchFolder.Name(), name)
+				continue
+			}
+			var version int
+			if _, err3 := fmt.Sscanf(name, "version_%d", &version); err3 != nil || name != fmt.Sprintf("version_%d", version) || !versionFolder.IsDir() {
+				continue
+			}
+
+			label := fmt.Sprintf("%s@%d", branchFolder.Name(), version)
+			record := v.verifyVersion(report, label, filepath.Join(branchDirectory, name))
+			if record != nil {
+				record.branch = branchFolder.Name()
+				record.version = version
+				commits[record.id] = record
+			}
+		}
+	}
+
+	// 父版本必須存在
+	for _, record := range sortedRecords(commits) {
+		for _, parent := range record.info.Parents {
+			if _, found := commits[parent]; !found {
+				report.errorf("version %s: parent %s does not exist", record.label(), shortID(parent))
+			}
+		}
+	}
+	return commits
+}
+
+// 檢查單一版本資料夾，提交資訊可以讀取時回傳該版本
+func (v *VCS) verifyVersion(report *fsckReport, label, versionDirectory string) *commitRecord {
+	commitData, err1 := os.ReadFile(filepath.Join(versionDirectory, commitFileName))
+	if os.IsNotExist(err1) {
+		report.errorf("version %s is missing %s", label, commitFileName)
+	} else if err1 != nil {
+		report.errorf("version %s: unable to read %s: %v", label, commitFileName, err1)
+	}
+	manifestData, err2 := os.ReadFile(filepath.Join(versionDirectory, manifestFileName))
+	if os.IsNotExist(err2) {
+		report.errorf("version %s is missing %s", label, manifestFileName)
+	} else if err2 != nil {
+		report.errorf("version %s: unable to read %s: %v", label, manifestFileName, err2)
+	}
+
+	// 版本清單中的每個檔案都必須在物件庫中
+	if err2 == nil {
+		m := manifest{}
+		if err3 := json.Unmarshal(manifestData, &m); err3 != nil {
+			report.errorf("version %s: unable to decode %s: %v", label, manifestFileName, err3)
+		} else {
+			for _, path := range m.paths() {
+				if len(m[path]) < 3 {
+					report.errorf("version %s: invalid object hash for %s", label, path)
+				} else if !v.objectExists(m[path]) {
+					report.errorf("version %s: object %s for %s is missing", label, shortID(m[path]), path)
+				}
+			}
+		}
+	}
+
+	if err1 != nil {
+		return nil
+	}
+	info := commitInfo{}
+	if err5 := json.Unmarshal(commitData, &info); err5 != nil {
+		report.errorf("version %s: unable to decode %s: %v", label, commitFileName, err5)
+		return nil
+	}
+	if err2 == nil && info.Manifest != hashBytes(manifestData) {
+		report.errorf("version %s: %s does not match the hash recorded in %s", label, manifestFileName, commitFileName)
+	}
+	var version int
+	fmt.Sscanf(filepath.Base(versionDirectory), "version_%d", &version)
+	if info.Version != version {
+		report.warnf("version %s records version number %d", label, info.Version)
+	}
+	return &commitRecord{id: hashBytes(commitData), directory: versionDirectory, info: info}
+}
+
+// 檢查每個history資料夾的版本編號是否有缺口
+// 分支資料夾的版本編號接續分出時的版本，缺少的編號可以沿著第一個父版本在其他資料夾找到時不算缺口
+func (v *VCS) verifyVersionNumbers(report *fsckReport, commits map[string]*commitRecord) {
+	folders := map[string][]*commitRecord{}
+	for _, record := range commits {
+		folders[record.branch] = append(folders[record.branch], record)
+	}
+
+	for _, folder := range sortedKeys(folders) {
+		covered := map[int]bool{}
+		highest := 0
+		for _, record := range folders[folder] {
+			highest = max(highest, record.version)
+			for current := record; current != nil; {
+				covered[current.version] = true
+				if len(current.info.Parents) == 0 {
+					break
+				}
+				current = commits[current.info.Parents[0]]
+			}
+		}
+		for version := 1; version < highest; version++ {
+			if !covered[version] {
+				report.warnf("version number %d is missing from %s", version, folder)
+			}
+		}
+	}
+}
+
+// 檢查物件庫中每個物件，包含打包檔中的物件，都可以讀取且還原後的內容與雜湊值相符
+func (v *VCS) verifyObjects(report *fsckReport) {
+	prefixes, err1 := os.ReadDir(v.objectsDirectory)
+	if err1 != nil {
+		report.errorf("unable to read objects folder: %v", err1)
+		return
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() || prefix.Name() == packFolderName {
+			continue
+		}
+		objects, err2 := os.ReadDir(filepath.Join(v.objectsDirectory, prefix.Name()))
+		if err2 != nil {
+			report.errorf("unable to read objects folder %s: %v", prefix.Name(), err2)
+			continue
+		}
+		for _, object := range objects {
+			if strings.HasPrefix(object.Name(), temporaryPrefix) {
+				report.warnf("incomplete object file %s/%s", prefix.Name(), object.Name())
+				continue
+			}
+			v.verifyObject(report, prefix.Name()+object.Name())
+		}
+	}
+
+	// 打包檔中的物件
+	packs, err3 := v.packedObjects()
+	if err3 != nil {
+		report.errorf("%v", err3)
+		return
+	}
+	for _, hash := range sortedKeys(packs) {
+		if _, err4 := os.Stat(v.objectPath(hash)); err4 == nil {
+			continue
+		}
+		v.verifyObject(report, hash)
+	}
+}
+
+// 檢查單一物件可以讀取，且還原後的內容與雜湊值相符
+func (v *VCS) verifyObject(report *fsckReport, hash string) {
+	data, err := v.readObject(hash)
+	if err != nil {
+		report.errorf("%v", err)
+		return
+	}
+	if hashBytes(data) != hash {
+		report.errorf("object %s: content does not match its hash", shortID(hash))
+	}
+}
+
+// 檢查branch與tag指向的版本是否存在
+func (v *VCS) verifyRefs(report *fsckReport, commits map[string]*commitRecord) {
+	branches, err1 := v.branchNames()
+	if err1 != nil {
+		report.errorf("%v", err1)
+	}
+	for _, branch := range branches {
+		head, err2 := v.readBranchHead(branch)
+		if err2 != nil {
+			report.errorf("%v", err2)
+			continue
+		}
+		if _, found := commits[head]; head != "" && !found {
+			report.errorf("branch %s points to version %s, which does not exist", branch, shortID(head))
+		}
+	}
+
+	tags, err3 := v.tagNames()
+	if err3 != nil {
+		report.errorf("%v", err3)
+	}
+	for _, tag := range tags {
+		target, _, err4 := v.readTag(tag)
+		if err4 != nil {
+			report.errorf("%v", err4)
+			continue
+		}
+		if _, found := commits[target]; !found {
+			report.errorf("tag %s points to version %s, which does not exist", tag, shortID(target))
+		}
+	}
+}
+
+// 檢查currentBranch.txt、currentCommit.txt、進行中的合併狀態與中斷的提交
+func (v *VCS) verifyPointers(report *fsckReport, commits map[string]*commitRecord) {
+	err1 := v.readCurrentBranch()
+	if err1 != nil {
+		report.errorf("%v", err1)
+		return
+	}
+	if !v.detached() && !v.branchExists(v.currentBranch) {
+		report.errorf("currentBranch.txt points to branch %q, which does not exist", v.currentBranch)
+	}
+
+	err2 := v.readCurrentCommit()
+	if err2 != nil {
+		report.errorf("%v", err2)
+		return
+	}
+	if _, found := commits[v.currentCommit]; v.currentCommit != "" && !found {
+		report.errorf("currentCommit.txt points to version %s, which does not exist", shortID(v.currentCommit))
+	} else if !v.detached() && v.branchExists(v.currentBranch) {
+		if head, err3 := v.readBranchHead(v.currentBranch); err3 == nil && head != v.currentCommit {
+			report.warnf("current version %s is not the latest version of branch %s", shortID(v.currentCommit), v.currentBranch)
+		}
+	}
+
+	if _, err4 := v.readMergeState(); err4 != nil {
+		report.errorf("%v", err4)
+	}
+	if pending, err5 := v.readPendingCommit(); err5 != nil {
+		report.errorf("%v", err5)
+	} else if pending != nil {
+		report.warnf("commit %s to %s was interrupted and has not been finished", shortID(pending.Commit), pending.Branch)
+	}
+}
+
+// 檢查暫存區中的檔案都可以讀取
+func (v *VCS) verifyStagingArea(report *fsckReport) {
+	paths, err1 := v.stagedPaths()
+	if err1 != nil {
+		report.errorf("%v", err1)
+		return
+	}
+	for _, path := range paths {
+		if _, err2 := readStagedFile(v.stagedPath(path)); err2 != nil {
+			report.errorf("staged file %s: %v", path, err2)
+		}
+	}
+}
+
+// 依版本名稱排序，讓輸出的順序固定
+func sortedRecords(commits map[string]*commitRecord) []*commitRecord {
+	records := make([]*commitRecord, 0, len(commits))
+	for _, record := range commits {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].branch != records[j].branch {
+			return records[i].branch < records[j].branch
+		}
+		return records[i].version < records[j].version
+	})
+	return records
+}
+
+// 排序後的map索引
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,380 @@
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 預設的寬限期限：無法到達的資料超過此時間才會刪除
+const defaultPruneExpire = "2 weeks ago"
+
+// gc選項
+type GCOptions struct {
+	Prune  string // 只刪除早於此時間的無法到達資料，格式與@{<date>}相同，例如"1 week ago"或"now"；空字串為defaultPruneExpire
+	Repack bool   // 將所有物件打包成一個打包檔與索引
+}
+
+// 清理無法到達的資料：從branch、tag、目前版本、進行中的合併與.vcs/logs中的記錄出發，
+// 找出仍會用到的版本與物件（包含差異物件的基底），刪除其餘早於寬限期限的版本資料夾與物件
+func (v *VCS) GC(options GCOptions) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	err1 := v.loadState()
+	if err1 != nil {
+		return err1
+	}
+
+	if options.Prune == "" {
+		options.Prune = defaultPruneExpire
+	}
+	cutoff, err2 := parseRevisionDate(options.Prune)
+	if err2 != nil {
+		return fmt.Errorf("invalid --prune value: %v", err2)
+	}
+
+	// 過期的記錄不再保護它們指向的版本
+	expired, err3 := v.expireReflogs(time.Now().AddDate(0, 0, -reflogExpireDays))
+	if err3 != nil {
+		return err3
+	}
+	if expired > 0 {
+		fmt.Printf("Expired %d reflog %s older than %d days\n", expired, plural(expired, "entry", "entries"), reflogExpireDays)
+	}
+
+	// 仍會用到的版本：可以到達的版本，以及尚在寬限期限內的版本與它們的祖先
+	reachable, err4 := v.reachableCommits()
+	if err4 != nil {
+		return err4
+	}
+	commits, err5 := v.loadCommits()
+	if err5 != nil {
+		return err5
+	}
+	for _, record := range commits {
+		if reachable[record.id] || record.info.Timestamp.Before(cutoff) {
+			continue
+		}
+		ancestors, err6 := v.ancestors(record.id)
+		if err6 != nil {
+			return err6
+		}
+		for id := range ancestors {
+			reachable[id] = true
+		}
+	}
+	prunable := []*commitRecord{}
+	for _, record := range sortedRecords(commits) {
+		if !reachable[record.id] {
+			prunable = append(prunable, record)
+		}
+	}
+
+	keptObjects, err7 := v.keptObjects(commits, prunable)
+	if err7 != nil {
+		return err7
+	}
+
+	// 刪除版本資料夾
+	for _, record := range prunable {
+		err8 := os.RemoveAll(record.directory)
+		if err8 != nil {
+			return fmt.Errorf("unable to remove version %s: %v", record.label(), err8)
+		}
+	}
+	v.commits = nil
+	err9 := v.removeEmptyHistoryFolders()
+	if err9 != nil {
+		return err9
+	}
+	fmt.Printf("Pruned %d unreachable %s\n", len(prunable), plural(len(prunable), "version", "versions"))
+
+	// 刪除物件
+	prunedObjects, prunedBytes, err10 := v.pruneLooseObjects(keptObjects, cutoff)
+	if err10 != nil {
+		return err10
+	}
+	fmt.Printf("Pruned %d unreachable %s (%d bytes)\n", prunedObjects, plural(prunedObjects, "object", "objects"), prunedBytes)
+
+	if options.Repack {
+		return v.repack(keptObjects, cutoff)
+	}
+	return nil
+}
+
+// 從branch、tag、目前版本、進行中的合併與記錄出發，找出所有可以到達的版本
+func (v *VCS) reachableCommits() (map[string]bool, error) {
+	roots := []string{v.currentCommit}
+
+	branches, err1 := v.branchNames()
+	if err1 != nil {
+		return nil, err1
+	}
+	for _, branch := range branches {
+		head, err2 := v.readBranchHead(branch)
+		if err2 != nil {
+			return nil, err2
+		}
+		roots = append(roots, head)
+	}
+
+	tags, err3 := v.tagNames()
+	if err3 != nil {
+		return nil, err3
+	}
+	for _, tag := range tags {
+		target, _, err4 := v.readTag(tag)
+		if err4 != nil {
+			return nil, err4
+		}
+		roots = append(roots, target)
+	}
+
+	state, err5 := v.readMergeState()
+	if err5 != nil {
+		return nil, err5
+	}
+	if state != nil {
+		roots = append(roots, state.Commit, state.TargetCommit, state.SourceCommit, state.Base)
+	}
+
+	logPaths, err6 := v.reflogPaths()
+	if err6 != nil {
+		return nil, err6
+	}
+	for _, logPath := range logPaths {
+		entries, err7 := readReflog(logPath)
+		if err7 != nil {
+			return nil, err7
+		}
+		for _, entry := range entries {
+			roots = append(roots, entry.old, entry.new)
+		}
+	}
+
+	// 記錄中可能有已經不存在的版本，略過它們
+	commits, err8 := v.loadCommits()
+	if err8 != nil {
+		return nil, err8
+	}
+	reachable := map[string]bool{}
+	for _, root := range roots {
+		if _, found := commits[root]; !found || reachable[root] {
+			continue
+		}
+		ancestors, err9 := v.ancestors(root)
+		if err9 != nil {
+			return nil, err9
+		}
+		for id := range ancestors {
+			reachable[id] = true
+		}
+	}
+	return reachable, nil
+}
+
+// 找出保留的版本與進行中的合併會用到的物件，以及這些物件的差異基底
+func (v *VCS) keptObjects(commits map[string]*commitRecord, prunable []*commitRecord) (map[string]bool, error) {
+	pruned := map[string]bool{}
+	for _, record := range prunable {
+		pruned[record.id] = true
+	}
+
+	manifests := []manifest{}
+	for id, record := range commits {
+		if pruned[id] {
+			continue
+		}
+		m, err1 := readManifest(record.directory)
+		if err1 != nil {
+			return nil, fmt.Errorf("version %s: %v", record.label(), err1)
+		}
+		manifests = append(manifests, m)
+	}
+	state, err2 := v.readMergeState()
+	if err2 != nil {
+		return nil, err2
+	}
+	if state != nil {
+		manifests = append(manifests, state.StagedFiles, state.WorkingFiles, state.Merged)
+	}
+
+	kept := map[string]bool{}
+	for _, m := range manifests {
+		for _, hash := range m {
+			// 差異物件需要基底才能還原，沿著差異鏈保留所有基底
+			for hash != "" && !kept[hash] {
+				kept[hash] = true
+				object, err3 := v.readObjectFile(hash)
+				if err3 != nil {
+					return nil, err3
+				}
+				header, _, err4 := decodeObject(object)
+				if err4 != nil {
+					return nil, fmt.Errorf("corrupt object %s: %v", hash, err4)
+				}
+				hash = ""
+				if header.kind == objectDelta {
+					hash = header.base
+				}
+			}
+		}
+	}
+	return kept, nil
+}
+
+// 刪除沒有版本且不屬於任何branch的history資料夾
+func (v *VCS) removeEmptyHistoryFolders() error {
+	folders, err1 := os.ReadDir(v.historyDirectory)
+	if err1 != nil {
+		return fmt.Errorf("unable to read history folder: %v", err1)
+	}
+	for _, folder := range folders {
+		if !folder.IsDir() || v.branchExists(folder.Name()) {
+			continue
+		}
+		entries, err2 := os.ReadDir(filepath.Join(v.historyDirectory, folder.Name()))
+		if err2 != nil {
+			return fmt.Errorf("unable to read folder: %v", err2)
+		}
+		if len(entries) == 0 {
+			os.Remove(filepath.Join(v.historyDirectory, folder.Name()))
+		}
+	}
+	return nil
+}
+
+// 刪除不在kept中且修改時間早於cutoff的物件檔案，回傳刪除的數量與大小
+func (v *VCS) pruneLooseObjects(kept map[string]bool, cutoff time.Time) (int, int64, error) {
+	count := 0
+	size := int64(0)
+	err := v.walkLooseObjects(func(hash string, info os.FileInfo) error {
+		if kept[hash] || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		err := os.Remove(v.objectPath(hash))
+		if err != nil {
+			return fmt.Errorf("unable to remove object %s: %v", hash, err)
+		}
+		removeEmptyParents(filepath.Dir(v.objectPath(hash)), v.objectsDirectory)
+		count++
+		size += info.Size()
+		return nil
+	})
+	return count, size, err
+}
+
+// 走訪objects資料夾中未打包的物件檔案
+func (v *VCS) walkLooseObjects(fn func(hash string, info os.FileInfo) error) error {
+	prefixes, err1 := os.ReadDir(v.objectsDirectory)
+	if err1 != nil {
+		return fmt.Errorf("unable to read objects folder: %v", err1)
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() || prefix.Name() == packFolderName {
+			continue
+		}
+		objects, err2 := os.ReadDir(filepath.Join(v.objectsDirectory, prefix.Name()))
+		if err2 != nil {
+			return fmt.Errorf("unable to read objects folder %s: %v", prefix.Name(), err2)
+		}
+		for _, object := range objects {
+			if object.IsDir() || strings.HasPrefix(object.Name(), temporaryPrefix) {
+				continue
+			}
+			info, err3 := object.Info()
+			if err3 != nil {
+				return fmt.Errorf("unable to read object %s: %v", prefix.Name()+object.Name(), err3)
+			}
+			err4 := fn(prefix.Name()+object.Name(), info)
+			if err4 != nil {
+				return err4
+			}
+		}
+	}
+	return nil
+}
+
+// 將未打包的物件與既有打包檔中的物件寫成一個新的打包檔，再刪除已打包的物件檔案與舊的打包檔
+// 舊打包檔中無法到達的物件，在打包檔的修改時間早於cutoff時捨棄
+func (v *VCS) repack(kept map[string]bool, cutoff time.Time) error {
+	objects := map[string][]byte{}
+	loose := []string{}
+	err1 := v.walkLooseObjects(func(hash string, info os.FileInfo) error {
+		data, err := os.ReadFile(v.objectPath(hash))
+		if err != nil {
+			return fmt.Errorf("unable to read object %s: %v", hash, err)
+		}
+		objects[hash] = data
+		loose = append(loose, hash)
+		return nil
+	})
+	if err1 != nil {
+		return err1
+	}
+
+	packs, err2 := v.packedObjects()
+	if err2 != nil {
+		return err2
+	}
+	oldPacks := map[string]bool{}
+	dropped := 0
+	for hash, object := range packs {
+		oldPacks[object.pack] = true
+		if _, found := objects[hash]; found {
+			continue
+		}
+		if !kept[hash] {
+			if info, err3 := os.Stat(object.pack); err3 == nil && info.ModTime().Before(cutoff) {
+				dropped++
+				continue
+			}
+		}
+		data, err4 := readPackedObject(object)
+		if err4 != nil {
+			return fmt.Errorf("unable to read object %s from %s: %v", hash, filepath.Base(object.pack), err4)
+		}
+		objects[hash] = data
+	}
+	if len(objects) == 0 && len(oldPacks) == 0 {
+		fmt.Println("Nothing to repack")
+		return nil
+	}
+
+	name, err5 := v.writePack(objects)
+	if err5 != nil {
+		return err5
+	}
+
+	// 新的打包檔寫入完成後才刪除已打包的內容
+	newPack := filepath.Join(v.packDirectory(), name+".pack")
+	for pack := range oldPacks {
+		if pack == newPack {
+			continue
+		}
+		err6 := os.Remove(strings.TrimSuffix(pack, ".pack") + ".idx")
+		if err6 != nil {
+			return fmt.Errorf("unable to remove old pack index: %v", err6)
+		}
+		os.Remove(pack)
+	}
+	for _, hash := range loose {
+		err7 := os.Remove(v.objectPath(hash))
+		if err7 != nil {
+			return fmt.Errorf("unable to remove packed object %s: %v", hash, err7)
+		}
+		removeEmptyParents(filepath.Dir(v.objectPath(hash)), v.objectsDirectory)
+	}
+
+	fmt.Printf("Packed %d %s into %s.pack", len(objects), plural(len(objects), "object", "objects"), name)
+	if dropped > 0 {
+		fmt.Printf(", dropped %d unreachable packed %s", dropped, plural(dropped, "object", "objects"))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,394 @@
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 分離HEAD時currentBranch.txt的內容，代表目前不在任何branch上
+const detachedHead = "HEAD"
+
+// 分離HEAD時提交的版本所在的資料夾，以.開頭所以不會與branch名稱衝突
+const detachedFolder = ".detached"
+
+// 一個已提交的版本：提交資訊與其在history中的位置
+type commitRecord struct {
+	id        string
+	branch    string // 版本所在的history資料夾，即提交時的branch
+	version   int
+	directory string
+	info      commitInfo
+}
+
+// 顯示用的版本名稱，例如main@3
+func (record *commitRecord) label() string {
+	if record.branch == detachedFolder {
+		return fmt.Sprintf("detached@%d", record.version)
+	}
+	return fmt.Sprintf("%s@%d", record.branch, record.version)
+}
+
+// 讀取history中所有版本，以提交編號為索引
+func (v *VCS) loadCommits() (map[string]*commitRecord, error) {
+	if v.commits != nil {
+		return v.commits, nil
+	}
+
+	branchFolders, err1 := os.ReadDir(v.historyDirectory)
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to read history folder: %v", err1)
+	}
+
+	commits := map[string]*commitRecord{}
+	for _, branchFolder := range branchFolders {
+		if !branchFolder.IsDir() {
+			continue
+		}
+		branchDirectory := filepath.Join(v.historyDirectory, branchFolder.Name())
+		versionFolders, err2 := os.ReadDir(branchDirectory)
+		if err2 != nil {
+			return nil, fmt.Errorf("unable to read folder: %v", err2)
+		}
+
+		for _, versionFolder := range versionFolders {
+			var version int
+			if _, err3 := fmt.Sscanf(versionFolder.Name(), "version_%d", &version); err3 != nil {
+				continue
+			}
+			versionDirectory := filepath.Join(branchDirectory, versionFolder.Name())
+			info, id, err4 := readCommitInfo(versionDirectory)
+			if err4 != nil {
+				return nil, fmt.Errorf("version %s@%d: %v", branchFolder.Name(), version, err4)
+			}
+			commits[id] = &commitRecord{id: id, branch: branchFolder.Name(), version: version, directory: versionDirectory, info: info}
+		}
+	}
+
+	v.commits = commits
+	return commits, nil
+}
+
+// 依提交編號取得版本
+func (v *VCS) findCommit(id string) (*commitRecord, error) {
+	commits, err := v.loadCommits()
+	if err != nil {
+		return nil, err
+	}
+	record, found := commits[id]
+	if !found {
+		return nil, fmt.Errorf("commit %s does not exist", shortID(id))
+	}
+	return record, nil
+}
+
+// 取得branch中的指定版本
+// 版本不在branch資料夾中時，沿著branch的第一個父版本往回找，例如從main@3建立的feature可以用feature@3找到
+// branch資料夾中的版本不是branch最新版本的祖先時（例如已刪除的同名branch留下的版本），不屬於這個branch；
+// 分離HEAD資料夾中的版本則不論目前版本為何都可以找到
+func (v *VCS) findVersion(branch string, version int) (*commitRecord, error) {
+	// 分離HEAD的版本不屬於任何branch，從目前版本往回找
+	head := v.currentCommit
+	if branch != detachedFolder {
+		var err1 error
+		if head, err1 = v.readBranchHead(branch); err1 != nil {
+			return nil, err1
+		}
+	}
+
+	versionDirectory := filepath.Join(v.historyDirectory, branch, fmt.Sprintf("version_%d", version))
+	if info, id, err2 := readCommitInfo(versionDirectory); err2 == nil {
+		onBranch := branch == detachedFolder
+		if !onBranch && head != "" {
+			var err3 error
+			if onBranch, err3 = v.isAncestor(id, head); err3 != nil {
+				return nil, err3
+			}
+		}
+		if onBranch {
+			return &commitRecord{id: id, branch: branch, version: version, directory: versionDirectory, info: info}, nil
+		}
+	}
+
+	for id := head; id != ""; {
+		record, err4 := v.findCommit(id)
+		if err4 != nil {
+			return nil, err4
+		}
+		if record.version == version {
+			return record, nil
+		}
+		if record.version < version || len(record.info.Parents) == 0 {
+			break
+		}
+		id = record.info.Parents[0]
+	}
+	return nil, fmt.Errorf("version %d does not exist on branch %s", version, branch)
+}
+
+// 取得branch指標檔案的路徑
+func (v *VCS) branchRefPath(branch string) string {
+	return filepath.Join(v.refsDirectory, "heads", branch)
+}
+
+// 檢查branch是否存在
+func (v *VCS) branchExists(branch string) bool {
+	if branch == "" || strings.ContainsAny(branch, `/\`) {
+		return false
+	}
+	_, err := os.Stat(v.branchRefPath(branch))
+	return err == nil
+}
+
+// 讀取branch指向的提交編號，尚未有任何提交時回傳空字串
+func (v *VCS) readBranchHead(branch string) (string, error) {
+	if !v.branchExists(branch) {
+		return "", fmt.Errorf("branch %s does not exist", branch)
+	}
+	data, err := os.ReadFile(v.branchRefPath(branch))
+	if err != nil {
+		return "", fmt.Errorf("unable to read branch %s: %v", branch, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// 將branch指向指定的提交編號，並記錄在branch的記錄檔中
+func (v *VCS) writeBranchHead(branch, id string) error {
+	err1 := os.MkdirAll(filepath.Dir(v.branchRefPath(branch)), os.ModePerm)
+	if err1 != nil {
+		return fmt.Errorf("unable to create refs folder: %v", err1)
+	}
+	oldID := ""
+	if v.branchExists(branch) {
+		oldID, _ = v.readBranchHead(branch)
+	}
+	err2 := writeFileAtomic(v.branchRefPath(branch), []byte(id))
+	if err2 != nil {
+		return fmt.Errorf("unable to write branch %s: %v", branch, err2)
+	}
+	return appendReflog(v.branchReflogPath(branch), oldID, id)
+}
+
+// 取得branch最新的版本，尚未有任何提交時回傳nil
+func (v *VCS) branchHead(branch string) (*commitRecord, error) {
+	id, err := v.readBranchHead(branch)
+	if err != nil || id == "" {
+		return nil, err
+	}
+	return v.findCommit(id)
+}
+
+// 是否處於分離HEAD狀態
+func (v *VCS) detached() bool {
+	return v.currentBranch == detachedHead
+}
+
+// 檢查版本是否包含在任何branch或tag中，不包含時提醒使用者該版本在離開後將無法從branch找到
+func (v *VCS) warnIfUnreachable(id string) error {
+	if id == "" {
+		return nil
+	}
+	heads := []string{}
+	branches, err1 := v.branchNames()
+	if err1 != nil {
+		return err1
+	}
+	for _, branch := range branches {
+		head, err2 := v.readBranchHead(branch)
+		if err2 != nil {
+			return err2
+		}
+		heads = append(heads, head)
+	}
+	tags, err3 := v.tagNames()
+	if err3 != nil {
+		return err3
+	}
+	for _, tag := range tags {
+		if target, _, err4 := v.readTag(tag); err4 == nil {
+			heads = append(heads, target)
+		}
+	}
+
+	for _, head := range heads {
+		if head == "" {
+			continue
+		}
+		reachable, err5 := v.isAncestor(id, head)
+		if err5 != nil {
+			return err5
+		}
+		if reachable {
+			return nil
+		}
+	}
+
+	record, err6 := v.findCommit(id)
+	if err6 != nil {
+		return err6
+	}
+	fmt.Printf("Warning: you are leaving version %s (%s) behind; it is not on any branch.\n", record.label(), shortID(id))
+	fmt.Printf("  To keep it, create a branch for it with \"vcs create-branch <branch name> %s\".\n", shortID(id))
+	return nil
+}
+
+// 取得目前簽出的版本，尚未有任何提交時回傳nil
+func (v *VCS) currentRecord() (*commitRecord, error) {
+	if v.currentCommit == "" {
+		return nil, nil
+	}
+	return v.findCommit(v.currentCommit)
+}
+
+// 取得id與其所有祖先版本
+func (v *VCS) ancestors(id string) (map[string]bool, error) {
+	visited := map[string]bool{}
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == "" || visited[current] {
+			continue
+		}
+		visited[current] = true
+
+		record, err := v.findCommit(current)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, record.info.Parents...)
+	}
+	return visited, nil
+}
+
+// 檢查ancestor是否為descendant本身或其祖先
+func (v *VCS) isAncestor(ancestor, descendant string) (bool, error) {
+	if ancestor == "" {
+		return true, nil
+	}
+	ancestors, err := v.ancestors(descendant)
+	if err != nil {
+		return false, err
+	}
+	return ancestors[ancestor], nil
+}
+
+// 找出兩個版本最近的共同祖先，沒有共同祖先時回傳空字串
+func (v *VCS) mergeBase(a, b string) (string, error) {
+	if a == "" || b == "" {
+		return "", nil
+	}
+	ancestorsOfA, err1 := v.ancestors(a)
+	if err1 != nil {
+		return "", err1
+	}
+	ancestorsOfB, err2 := v.ancestors(b)
+	if err2 != nil {
+		return "", err2
+	}
+
+	common := []string{}
+	for id := range ancestorsOfA {
+		if ancestorsOfB[id] {
+			common = append(common, id)
+		}
+	}
+
+	// 排除是其他共同祖先之祖先的版本，只留下最近的候選
+	// 共同祖先的祖先也是共同祖先，因此某個共同祖先是其他共同祖先的祖先，等同於它是某個共同祖先的父版本
+	older := map[string]bool{}
+	for _, id := range common {
+		record, err3 := v.findCommit(id)
+		if err3 != nil {
+			return "", err3
+		}
+		for _, parent := range record.info.Parents {
+			older[parent] = true
+		}
+	}
+	candidates := []*commitRecord{}
+	for _, id := range common {
+		if older[id] {
+			continue
+		}
+		record, err4 := v.findCommit(id)
+		if err4 != nil {
+			return "", err4
+		}
+		candidates = append(candidates, record)
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	// 有多個候選時選擇最新的版本
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].info.Timestamp.After(candidates[j].info.Timestamp)
+	})
+	return candidates[0].id, nil
+}
+
+// 依時間排序，取得id與其所有祖先版本，最舊的在前
+func (v *VCS) history(id string) ([]*commitRecord, error) {
+	if id == "" {
+		return nil, nil
+	}
+	ancestors, err1 := v.ancestors(id)
+	if err1 != nil {
+		return nil, err1
+	}
+
+	records := []*commitRecord{}
+	for ancestor := range ancestors {
+		record, err2 := v.findCommit(ancestor)
+		if err2 != nil {
+			return nil, err2
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].info.Timestamp.Equal(records[j].info.Timestamp) {
+			return records[i].info.Timestamp.Before(records[j].info.Timestamp)
+		}
+		return records[i].version < records[j].version
+	})
+	return records, nil
+}
+
+// 顯示兩個版本最近的共同祖先版本，參數可以是branch或任何版本表示式
+func (v *VCS) MergeBase(firstRevision, secondRevision string) error {
+	err5 := v.loadState()
+	if err5 != nil {
+		return err5
+	}
+
+	first, err1 := v.resolveMergeRevision(firstRevision)
+	if err1 != nil {
+		return err1
+	}
+	second, err2 := v.resolveMergeRevision(secondRevision)
+	if err2 != nil {
+		return err2
+	}
+
+	// 尚無版本的branch與任何版本都沒有共同祖先
+	base := ""
+	if first != nil && second != nil {
+		var err3 error
+		if base, err3 = v.mergeBase(first.id, second.id); err3 != nil {
+			return err3
+		}
+	}
+	if base == "" {
+		return fmt.Errorf("%s and %s have no common ancestor", firstRevision, secondRevision)
+	}
+
+	record, err4 := v.findCommit(base)
+	if err4 != nil {
+		return err4
+	}
+	fmt.Printf("%s %s\n", record.label(), record.id)
+	return nil
+}
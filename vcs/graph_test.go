@@ -0,0 +1,74 @@
+package vcs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 依「版本:父版本,父版本」的描述建立只存在記憶體中的版本圖，版本依描述的順序由舊到新
+func newTestGraph(description string) *VCS {
+	v := &VCS{commits: map[string]*commitRecord{}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, node := range strings.Fields(description) {
+		id, parents, _ := strings.Cut(node, ":")
+		info := commitInfo{Timestamp: start.Add(time.Duration(i) * time.Minute)}
+		if parents != "" {
+			info.Parents = strings.Split(parents, ",")
+		}
+		v.commits[id] = &commitRecord{id: id, branch: "main", version: i + 1, info: info}
+	}
+	return v
+}
+
+func TestMergeBase(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph string
+		a, b  string
+		want  string
+	}{
+		{"same version", "a b:a", "b", "b", "b"},
+		{"ancestor", "a b:a c:b", "a", "c", "a"},
+		{"fork", "a b:a c:b d:b", "c", "d", "b"},
+		{"after a merge", "a b:a c:a d:b,c e:c", "d", "e", "c"},
+		{"criss-cross picks the newest", "a b:a c:a d:b,c e:c,b", "d", "e", "c"},
+		{"unrelated", "a b c:b", "a", "c", ""},
+		{"empty side", "a", "a", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := newTestGraph(test.graph)
+			got, err := v.mergeBase(test.a, test.b)
+			if err != nil {
+				t.Fatalf("mergeBase: %v", err)
+			}
+			if got != test.want {
+				t.Fatalf("mergeBase(%s, %s) = %q, want %q", test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeBaseLongHistory(t *testing.T) {
+	// 每個共同祖先互相比較時，長的線性歷史需要數秒
+	nodes := []string{"c0"}
+	for i := 1; i < 5000; i++ {
+		nodes = append(nodes, fmt.Sprintf("c%d:c%d", i, i-1))
+	}
+	nodes = append(nodes, "side:c4000")
+	v := newTestGraph(strings.Join(nodes, " "))
+
+	started := time.Now()
+	got, err := v.mergeBase("c4999", "side")
+	if err != nil {
+		t.Fatalf("mergeBase: %v", err)
+	}
+	if got != "c4000" {
+		t.Fatalf("mergeBase = %q, want c4000", got)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("mergeBase took %v for a 5000-version history", elapsed)
+	}
+}
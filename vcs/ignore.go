@@ -0,0 +1,166 @@
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 忽略規則的檔名，放在工作目錄最上層
+const ignoreFileName = ".vcsignore"
+
+// 單一忽略規則
+type ignoreRule struct {
+	pattern       *regexp.Regexp
+	negate        bool // 以!開頭，重新納入先前被忽略的路徑
+	directoryOnly bool // 以/結尾，只比對資料夾
+}
+
+// 依序排列的忽略規則，後面的規則優先
+type ignoreRules []ignoreRule
+
+// 讀取工作目錄中的.vcsignore，檔案不存在時回傳空規則
+func loadIgnoreRules(workingDirectory string) (ignoreRules, error) {
+	content, err := os.ReadFile(filepath.Join(workingDirectory, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", ignoreFileName, err)
+	}
+	return parseIgnoreRules(string(content)), nil
+}
+
+// 解析gitignore格式的規則
+func parseIgnoreRules(content string) ignoreRules {
+	rules := ignoreRules{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			// \#與\!用來表示以#或!開頭的檔名
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.directoryOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		pattern, err := compilePathPattern(line)
+		if err != nil {
+			continue
+		}
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// 編譯路徑比對規則：含有/的規則相對於工作目錄比對，否則比對任何一層的名稱
+func compilePathPattern(glob string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(glob, "/")
+	glob = strings.TrimPrefix(glob, "/")
+	expression := globToRegexp(glob)
+	if anchored {
+		expression = "^" + expression + "$"
+	} else {
+		expression = "^(?:.*/)?" + expression + "$"
+	}
+	return regexp.Compile(expression)
+}
+
+// 將glob轉換成正規表示式，支援*、?、[...]與**
+func globToRegexp(glob string) string {
+	var builder strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			builder.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			builder.WriteString(".*")
+			i++
+		case c == '*':
+			builder.WriteString("[^/]*")
+		case c == '?':
+			builder.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				builder.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return builder.String()
+}
+
+// 判斷相對路徑是否被忽略，以最後一條符合的規則為準
+func (rules ignoreRules) ignored(path string, isDirectory bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.directoryOnly && !isDirectory {
+			continue
+		}
+		if rule.pattern.MatchString(path) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// 走訪工作區中未被忽略的檔案，永遠略過.vcs資料夾
+// root為相對於工作目錄的路徑，fn收到的也是以/分隔的相對路徑
+func (v *VCS) walkWorkingTree(root string, fn func(path string) error) error {
+	rules, err1 := loadIgnoreRules(v.workingDirectory)
+	if err1 != nil {
+		return err1
+	}
+	repoName := filepath.Base(v.repoDirectory)
+
+	err2 := filepath.WalkDir(v.workingPath(root), func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, _ := filepath.Rel(v.workingDirectory, filePath)
+		path := filepath.ToSlash(relativePath)
+		if path == "." {
+			return nil
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == repoName || rules.ignored(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || rules.ignored(path, false) {
+			return nil
+		}
+		return fn(path)
+	})
+	if err2 != nil {
+		return fmt.Errorf("unable to walk working directory: %v", err2)
+	}
+	return nil
+}
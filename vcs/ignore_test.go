@@ -0,0 +1,141 @@
+package vcs
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{"*.log", []string{"a.log", ".log"}, []string{"a.log.txt", "dir/a.log", "a.lo"}},
+		{"?.txt", []string{"a.txt"}, []string{"ab.txt", "/.txt"}},
+		{"file[0-9].go", []string{"file1.go"}, []string{"filex.go", "file10.go"}},
+		{"file[!0-9].go", []string{"filex.go"}, []string{"file1.go"}},
+		{"[abc", []string{"[abc"}, []string{"a"}},
+		{"a.b+c", []string{"a.b+c"}, []string{"axb+c", "a.bbc"}},
+		{"**/foo", []string{"foo", "a/foo", "a/b/foo"}, []string{"afoo", "foo/a"}},
+		{"foo/**", []string{"foo/a", "foo/a/b"}, []string{"foo", "bar/foo/a"}},
+		{"a/**/b", []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"a/xb", "b"}},
+		{"a/*/b", []string{"a/x/b"}, []string{"a/b", "a/x/y/b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.glob, func(t *testing.T) {
+			pattern := regexp.MustCompile("^" + globToRegexp(test.glob) + "$")
+			for _, path := range test.matches {
+				if !pattern.MatchString(path) {
+					t.Errorf("%q does not match %q", test.glob, path)
+				}
+			}
+			for _, path := range test.misses {
+				if pattern.MatchString(path) {
+					t.Errorf("%q matches %q", test.glob, path)
+				}
+			}
+		})
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	const content = `# comment
+*.log
+!keep.log
+build/
+/todo.txt
+docs/**/*.tmp
+\#notes
+\!important
+**/cache
+vendor/**
+`
+	rules := parseIgnoreRules(content)
+
+	tests := []struct {
+		path        string
+		isDirectory bool
+		want        bool
+	}{
+		{"debug.log", false, true},
+		{"sub/dir/debug.log", false, true},
+		{"keep.log", false, false},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"src/build", true, true},
+		{"build", false, false},
+		{"todo.txt", false, true},
+		{"sub/todo.txt", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/x/y/a.tmp", false, true},
+		{"a.tmp", false, false},
+		{"#notes", false, true},
+		{"!important", false, true},
+		{"important", false, false},
+		{"cache", true, true},
+		{"a/b/cache", false, true},
+		{"vendor/lib/a.go", false, true},
+		{"comment", false, false},
+		{"main.go", false, false},
+	}
+	for _, test := range tests {
+		if got := rules.ignored(test.path, test.isDirectory); got != test.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", test.path, test.isDirectory, got, test.want)
+		}
+	}
+}
+
+func TestIgnoreNegationOrder(t *testing.T) {
+	// 後面的規則優先，重新忽略先前重新納入的檔案
+	rules := parseIgnoreRules("*.log\n!keep.log\nkeep.log\n")
+	if !rules.ignored("keep.log", false) {
+		t.Fatalf("keep.log should be ignored again by the last rule")
+	}
+	if got := parseIgnoreRules("\n   \n# only comments\n/\n"); len(got) != 0 {
+		t.Fatalf("parseIgnoreRules returned %d rules for blank lines and comments, want 0", len(got))
+	}
+}
+
+func TestWalkWorkingTree(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		ignoreFileName:     "*.log\n!keep.log\nbuild/\nvendor/**\n!vendor/keep/**\n",
+		"main.go":          "",
+		"debug.log":        "",
+		"keep.log":         "",
+		"build/out.bin":    "",
+		"src/build/x.o":    "",
+		"src/app.go":       "",
+		"vendor/lib/a.go":  "",
+		"vendor/keep/a.go": "",
+		".vcs/lock":        "",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 被忽略的資料夾整個略過，其中重新納入的檔案也不會走訪到
+	var got []string
+	err := NewVCSAt(root).walkWorkingTree(".", func(path string) error {
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ignoreFileName, "keep.log", "main.go", "src/app.go"}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Fatalf("walkWorkingTree visited %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 儲存庫鎖的檔名，內容為持有鎖的程序編號
+const lockFileName = "lock"
+
+// 鎖由其他程序持有時，每隔lockRetryInterval重試一次，最多等待lockTimeout
+// 其他指令（例如編輯器定時執行的status）通常很快就會釋放鎖
+const (
+	lockTimeout       = 3 * time.Second
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+// 取得儲存庫鎖的路徑
+func (v *VCS) lockPath() string {
+	return filepath.Join(v.repoDirectory, lockFileName)
+}
+
+// 嘗試取得儲存庫鎖，鎖由其他仍在執行的程序持有時回傳false與該程序編號
+// 持有鎖的程序已結束或鎖的內容無法辨識時，視為過期的鎖並移除
+func (v *VCS) tryLock() (bool, int, error) {
+	if v.lockDepth > 0 {
+		v.lockDepth++
+		return true, 0, nil
+	}
+
+	// 先寫入程序自己的暫存檔，再以硬連結建立鎖，其他程序讀到的鎖一定含有完整的程序編號
+	pid := os.Getpid()
+	temporaryPath := filepath.Join(v.repoDirectory, fmt.Sprintf("%s%s.%d", temporaryPrefix, lockFileName, pid))
+	err1 := os.WriteFile(temporaryPath, []byte(strconv.Itoa(pid)), 0644)
+	if err1 != nil {
+		return false, 0, fmt.Errorf("unable to create lock file: %v", err1)
+	}
+	defer os.Remove(temporaryPath)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err2 := os.Link(temporaryPath, v.lockPath())
+		if err2 == nil {
+			v.lockDepth = 1
+			return true, 0, nil
+		}
+		if !os.IsExist(err2) {
+			return false, 0, fmt.Errorf("unable to create lock file: %v", err2)
+		}
+
+		data, err3 := os.ReadFile(v.lockPath())
+		if os.IsNotExist(err3) {
+			continue
+		}
+		if err3 != nil {
+			return false, 0, fmt.Errorf("unable to read lock file: %v", err3)
+		}
+		holder, err4 := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err4 == nil && holder != pid && processAlive(holder) {
+			return false, holder, nil
+		}
+
+		// 過期的鎖：確認內容沒有被其他程序換掉後才移除
+		if current, err5 := os.ReadFile(v.lockPath()); err5 == nil && string(current) == string(data) {
+			fmt.Printf("Removing stale lock left by process %s\n", strings.TrimSpace(string(data)))
+			err6 := os.Remove(v.lockPath())
+			if err6 != nil && !os.IsNotExist(err6) {
+				return false, 0, fmt.Errorf("unable to remove stale lock file: %v", err6)
+			}
+		}
+	}
+	return false, 0, fmt.Errorf("unable to acquire lock %s", v.lockPath())
+}
+
+// 取得儲存庫鎖，其他程序持有鎖超過lockTimeout時傳回錯誤
+// 會修改儲存庫的操作在開始時呼叫，並以defer v.unlock()釋放
+func (v *VCS) lock() error {
+	if _, err := os.Stat(v.repoDirectory); os.IsNotExist(err) {
+		return fmt.Errorf("not a vcs repository (run \"vcs init\" first)")
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		acquired, holder, err := v.tryLock()
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("another vcs process (pid %d) is using the repository; if it is no longer running, remove %s", holder, v.lockPath())
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// 釋放儲存庫鎖，巢狀取得時只在最外層釋放
+func (v *VCS) unlock() {
+	if v.lockDepth == 0 {
+		return
+	}
+	v.lockDepth--
+	if v.lockDepth == 0 {
+		os.Remove(v.lockPath())
+	}
+}
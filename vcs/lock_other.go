@@ -0,0 +1,18 @@
+//go:build !unix
+
+package vcs
+
+import "os"
+
+// 檢查程序是否仍在執行：Windows上程序不存在時無法開啟
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
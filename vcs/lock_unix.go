@@ -0,0 +1,14 @@
+//go:build unix
+
+package vcs
+
+import "syscall"
+
+// 檢查程序是否仍在執行：送出signal 0，沒有權限也代表程序存在
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,708 @@
+package vcs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 衝突標記
+const (
+	conflictStart     = "<<<<<<< "
+	conflictSeparator = "======="
+	conflictEnd       = ">>>>>>> "
+)
+
+// 合併策略，決定兩邊修改到相同的行時如何處理
+type MergeStrategy string
+
+const (
+	MergeRecursive MergeStrategy = "recursive" // 以衝突標記寫入檔案，等待手動解決
+	MergeOurs      MergeStrategy = "ours"      // 採用目標branch的內容
+	MergeTheirs    MergeStrategy = "theirs"    // 採用來源branch的內容
+	MergeUnion     MergeStrategy = "union"     // 依序保留兩邊的內容，不加衝突標記
+)
+
+// 解析合併策略名稱
+func ParseMergeStrategy(name string) (MergeStrategy, error) {
+	switch strategy := MergeStrategy(name); strategy {
+	case MergeRecursive, MergeOurs, MergeTheirs, MergeUnion:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown merge strategy %q (choices are recursive, ours, theirs, union)", name)
+}
+
+// 指定路徑使用的合併策略，Pattern的格式與.vcsignore的規則相同
+type PathStrategy struct {
+	Pattern  string
+	Strategy MergeStrategy
+}
+
+// 目標branch是來源branch的祖先時是否快轉
+type FastForwardMode string
+
+const (
+	FastForwardAuto FastForwardMode = ""        // 可以快轉時直接移動目標branch，否則建立合併版本
+	NoFastForward   FastForwardMode = "no-ff"   // 一律建立合併版本
+	FastForwardOnly FastForwardMode = "ff-only" // 只允許快轉，無法快轉時停止
+)
+
+// 合併選項
+type MergeOptions struct {
+	Strategy       MergeStrategy  // 預設的合併策略，空字串代表recursive
+	PathStrategies []PathStrategy // 依路徑覆寫合併策略，有多條符合時以最後一條為準
+	FastForward    FastForwardMode
+	DryRun         bool // 只預覽合併結果，不寫入版本、暫存區與工作區
+	Diffstat       bool // 計算每個檔案相對於目標branch的新增與刪除行數
+}
+
+// 合併時對單一檔案的處理方式
+type MergeAction string
+
+const (
+	MergeAdded      MergeAction = "added"       // 來源branch新增的檔案
+	MergeRemoved    MergeAction = "removed"     // 來源branch刪除的檔案
+	MergeUpdated    MergeAction = "updated"     // 只有來源branch修改，採用來源branch的內容
+	MergeAutoMerged MergeAction = "auto-merged" // 兩邊都有修改，逐行合併沒有衝突
+	MergeResolved   MergeAction = "resolved"    // 有衝突，已依合併策略解決
+	MergeConflict   MergeAction = "conflict"    // 有衝突，需要手動解決
+)
+
+// 合併結果中單一檔案的處理方式，只列出目標branch會改變或有衝突的檔案
+type MergeDecision struct {
+	Path     string
+	Action   MergeAction
+	Strategy MergeStrategy // 兩邊都有修改時使用的合併策略
+	Detail   string        // 衝突說明
+	hash     string        // 合併後內容的雜湊值，空字串代表檔案被刪除
+	data     []byte        // 逐行合併產生的新內容，尚未存入物件庫
+
+	// 相對於目標branch的新增與刪除行數，只在MergeOptions.Diffstat時計算
+	Insertions int
+	Deletions  int
+	Binary     bool
+}
+
+// 一段相對於基底的變更：以lines取代base[start:end]
+type mergeHunk struct {
+	start int
+	end   int
+	lines []string
+}
+
+// 檢查合併選項中的策略與路徑規則
+func (options MergeOptions) validate() error {
+	switch options.FastForward {
+	case FastForwardAuto, NoFastForward, FastForwardOnly:
+	default:
+		return fmt.Errorf("unknown fast-forward mode %q", options.FastForward)
+	}
+	if options.Strategy != "" {
+		if _, err := ParseMergeStrategy(string(options.Strategy)); err != nil {
+			return err
+		}
+	}
+	for _, rule := range options.PathStrategies {
+		if _, err1 := ParseMergeStrategy(string(rule.Strategy)); err1 != nil {
+			return err1
+		}
+		if _, err2 := compilePathPattern(rule.Pattern); err2 != nil {
+			return fmt.Errorf("invalid path pattern %q: %v", rule.Pattern, err2)
+		}
+	}
+	return nil
+}
+
+// 取得路徑使用的合併策略
+func (options MergeOptions) strategyFor(path string) MergeStrategy {
+	strategy := options.Strategy
+	if strategy == "" {
+		strategy = MergeRecursive
+	}
+	for _, rule := range options.PathStrategies {
+		if pattern, err := compilePathPattern(rule.Pattern); err == nil && pattern.MatchString(path) {
+			strategy = rule.Strategy
+		}
+	}
+	return strategy
+}
+
+// 找出other相對於base的所有變更區塊
+func changeHunks(base, other []string) []mergeHunk {
+	hunks := []mergeHunk{}
+	lines := diffLines(base, other)
+	position := 0
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			position++
+			i++
+			continue
+		}
+
+		hunk := mergeHunk{start: position, end: position}
+		for ; i < len(lines) && lines[i].kind != ' '; i++ {
+			if lines[i].kind == '-' {
+				hunk.end++
+				position++
+			} else {
+				hunk.lines = append(hunk.lines, lines[i].text)
+			}
+		}
+		hunks = append(hunks, hunk)
+	}
+	return hunks
+}
+
+// 將同一邊的變更區塊套用到base[start:end]
+func applyHunks(base []string, start, end int, hunks []mergeHunk) []string {
+	lines := []string{}
+	position := start
+	for _, hunk := range hunks {
+		lines = append(lines, base[position:hunk.start]...)
+		lines = append(lines, hunk.lines...)
+		position = hunk.end
+	}
+	return append(lines, base[position:end]...)
+}
+
+// 比較兩組行是否相同
+func sameLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 三方合併：以base為基底合併ours與theirs的變更
+// 只有一邊修改的區塊直接採用，兩邊修改到相同或相鄰的行且結果不同時為衝突，依strategy處理：
+// recursive以衝突標記寫出兩邊的內容，ours與theirs採用其中一邊，union依序保留兩邊
+// 回傳合併後的內容與衝突區塊數
+func merge3(base, ours, theirs []string, oursLabel, theirsLabel string, strategy MergeStrategy) ([]string, int) {
+	oursHunks := changeHunks(base, ours)
+	theirsHunks := changeHunks(base, theirs)
+
+	result := []string{}
+	conflicts := 0
+	position := 0
+	i, j := 0, 0
+	for i < len(oursHunks) || j < len(theirsHunks) {
+		// 從最前面的變更開始，把範圍重疊或相鄰的變更歸成一組
+		start := 0
+		if j >= len(theirsHunks) || (i < len(oursHunks) && oursHunks[i].start <= theirsHunks[j].start) {
+			start = oursHunks[i].start
+		} else {
+			start = theirsHunks[j].start
+		}
+		end := start
+		oursFrom, theirsFrom := i, j
+		for grown := true; grown; {
+			grown = false
+			if i < len(oursHunks) && oursHunks[i].start <= end {
+				end = max(end, oursHunks[i].end)
+				i++
+				grown = true
+			}
+			if j < len(theirsHunks) && theirsHunks[j].start <= end {
+				end = max(end, theirsHunks[j].end)
+				j++
+				grown = true
+			}
+		}
+
+		result = append(result, base[position:start]...)
+		position = end
+
+		oursLines := applyHunks(base, start, end, oursHunks[oursFrom:i])
+		theirsLines := applyHunks(base, start, end, theirsHunks[theirsFrom:j])
+		switch {
+		case theirsFrom == j:
+			result = append(result, oursLines...)
+		case oursFrom == i:
+			result = append(result, theirsLines...)
+		case sameLines(oursLines, theirsLines):
+			result = append(result, oursLines...)
+		case strategy == MergeOurs:
+			conflicts++
+			result = append(result, oursLines...)
+		case strategy == MergeTheirs:
+			conflicts++
+			result = append(result, theirsLines...)
+		case strategy == MergeUnion:
+			conflicts++
+			result = appendConflictLines(result, oursLines)
+			result = append(result, theirsLines...)
+		default:
+			conflicts++
+			result = append(result, conflictStart+oursLabel+"\n")
+			result = appendConflictLines(result, oursLines)
+			result = append(result, conflictSeparator+"\n")
+			result = appendConflictLines(result, theirsLines)
+			result = append(result, conflictEnd+theirsLabel+"\n")
+		}
+	}
+	return append(result, base[position:]...), conflicts
+}
+
+// 加入衝突區塊中的內容，缺少結尾換行時補上，讓衝突標記獨立成行
+func appendConflictLines(result, lines []string) []string {
+	for _, line := range lines {
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// 合併單一檔案：依三個版本的雜湊值判斷採用哪一邊，兩邊都有修改時依合併策略逐行合併
+// 目標branch不需改變時回傳nil
+func (v *VCS) mergePath(path string, base, ours, theirs manifest, oursLabel, theirsLabel string, strategy MergeStrategy) (*MergeDecision, error) {
+	baseHash, inBase := base[path]
+	oursHash, inOurs := ours[path]
+	theirsHash, inTheirs := theirs[path]
+
+	// 只有一邊修改時直接採用修改的一邊
+	switch {
+	case inOurs == inTheirs && oursHash == theirsHash:
+		return nil, nil
+	case inTheirs == inBase && theirsHash == baseHash:
+		return nil, nil
+	case inOurs == inBase && oursHash == baseHash:
+		decision := &MergeDecision{Path: path, Action: MergeUpdated, hash: theirsHash}
+		if !inTheirs {
+			decision.Action = MergeRemoved
+		} else if !inOurs {
+			decision.Action = MergeAdded
+		}
+		return decision, nil
+	}
+
+	// 兩邊都有修改，無法逐行合併時依合併策略採用其中一邊
+	decision := &MergeDecision{Path: path, Strategy: strategy, hash: oursHash}
+	resolve := func(detail string) (*MergeDecision, error) {
+		switch strategy {
+		case MergeOurs:
+			decision.Action = MergeResolved
+			decision.hash = oursHash
+		case MergeTheirs:
+			decision.Action = MergeResolved
+			decision.hash = theirsHash
+		default:
+			decision.Action = MergeConflict
+			decision.Detail = detail
+		}
+		return decision, nil
+	}
+
+	// 一邊刪除、另一邊修改，recursive與union保留修改的一邊
+	if !inOurs || !inTheirs {
+		deletedIn, modifiedIn := theirsLabel, oursLabel
+		if !inOurs {
+			deletedIn, modifiedIn = oursLabel, theirsLabel
+			decision.hash = theirsHash
+		}
+		if strategy == MergeUnion {
+			decision.Action = MergeResolved
+			return decision, nil
+		}
+		return resolve(fmt.Sprintf("modify/delete: %s deleted in %s and modified in %s", path, deletedIn, modifiedIn))
+	}
+
+	var baseData []byte
+	if inBase {
+		data, err1 := v.readObject(baseHash)
+		if err1 != nil {
+			return nil, err1
+		}
+		baseData = data
+	}
+	oursData, err2 := v.readObject(oursHash)
+	if err2 != nil {
+		return nil, err2
+	}
+	theirsData, err3 := v.readObject(theirsHash)
+	if err3 != nil {
+		return nil, err3
+	}
+
+	// 二進位檔無法逐行合併，recursive與union保留ours的內容
+	if isBinary(baseData) || isBinary(oursData) || isBinary(theirsData) {
+		return resolve(fmt.Sprintf("binary: merge conflict in %s", path))
+	}
+
+	lines, conflicts := merge3(splitLines(baseData), splitLines(oursData), splitLines(theirsData), oursLabel, theirsLabel, strategy)
+	decision.data = []byte(strings.Join(lines, ""))
+	decision.hash = hashBytes(decision.data)
+	switch {
+	case conflicts == 0:
+		decision.Action = MergeAutoMerged
+	case strategy == MergeRecursive:
+		decision.Action = MergeConflict
+		decision.Detail = fmt.Sprintf("content: merge conflict in %s", path)
+	default:
+		decision.Action = MergeResolved
+	}
+	return decision, nil
+}
+
+// 合併兩個版本清單，回傳合併後的清單與每個有變動的檔案的處理方式
+func (v *VCS) mergeManifests(base, ours, theirs manifest, oursLabel, theirsLabel string, options MergeOptions) (manifest, []MergeDecision, error) {
+	paths := manifest{}
+	for _, m := range []manifest{base, ours, theirs} {
+		for path := range m {
+			paths[path] = ""
+		}
+	}
+
+	merged := manifest{}
+	for path, hash := range ours {
+		merged[path] = hash
+	}
+	decisions := []MergeDecision{}
+	for _, path := range paths.paths() {
+		decision, err := v.mergePath(path, base, ours, theirs, oursLabel, theirsLabel, options.strategyFor(path))
+		if err != nil {
+			return nil, nil, err
+		}
+		if decision == nil {
+			continue
+		}
+
+		// 逐行合併產生的內容存入物件庫，預覽時不寫入
+		if decision.data != nil && !options.DryRun {
+			if _, err = v.writeObject(path, decision.data, ours[path]); err != nil {
+				return nil, nil, err
+			}
+		}
+		if decision.hash != "" {
+			merged[path] = decision.hash
+		} else {
+			delete(merged, path)
+		}
+		decisions = append(decisions, *decision)
+	}
+	return merged, decisions, nil
+}
+
+// 快轉合併：將目標branch指向來源branch的最新版本，不建立合併版本
+func (v *VCS) fastForward(targetBranch string, sourceHead *commitRecord, targetManifest, sourceManifest manifest) ([]MergeDecision, error) {
+	// 以目標branch為基底比較，列出快轉後會改變的檔案
+	_, decisions, err1 := v.mergeManifests(targetManifest, targetManifest, sourceManifest, targetBranch, sourceHead.branch, MergeOptions{})
+	if err1 != nil {
+		return nil, err1
+	}
+
+	// 先檢查工作區中會被覆蓋的未追蹤檔案，停止時不移動目標branch
+	plan, err5 := v.planCheckout(sourceHead, CheckoutOptions{})
+	if err5 != nil {
+		return nil, err5
+	}
+
+	err2 := v.writeBranchHead(targetBranch, sourceHead.id)
+	if err2 != nil {
+		return nil, err2
+	}
+
+	// 切換到目標branch，並將來源branch的版本寫入工作區與暫存區
+	v.currentBranch = targetBranch
+	err3 := v.writeCurrentBranch()
+	if err3 != nil {
+		return nil, err3
+	}
+	err4 := v.completeCheckout(plan, sourceHead)
+	if err4 != nil {
+		return nil, err4
+	}
+
+	fmt.Printf("Fast-forward %s to %s (%s)\n", targetBranch, sourceHead.label(), shortID(sourceHead.id))
+	return decisions, nil
+}
+
+// 列出合併預覽，需要時計算每個檔案相對於目標branch的行數變化
+func (v *VCS) previewMerge(decisions []MergeDecision, targetManifest manifest, options MergeOptions) ([]MergeDecision, error) {
+	if len(decisions) == 0 {
+		fmt.Println("\tno file changes")
+	}
+	for i := range decisions {
+		decision := &decisions[i]
+		if decision.Detail != "" {
+			fmt.Printf("\t%-12s %s (%s)\n", decision.Action+":", decision.Path, decision.Detail)
+		} else {
+			fmt.Printf("\t%-12s %s\n", decision.Action+":", decision.Path)
+		}
+		if !options.Diffstat {
+			continue
+		}
+
+		// 比較目標branch與合併後的內容
+		var oldData, newData []byte
+		if hash, exists := targetManifest[decision.Path]; exists {
+			data, err1 := v.readObject(hash)
+			if err1 != nil {
+				return nil, err1
+			}
+			oldData = data
+		}
+		switch {
+		case decision.data != nil:
+			newData = decision.data
+		case decision.hash != "":
+			data, err2 := v.readObject(decision.hash)
+			if err2 != nil {
+				return nil, err2
+			}
+			newData = data
+		}
+		decision.Binary = isBinary(oldData) || isBinary(newData)
+		if !decision.Binary {
+			decision.Insertions, decision.Deletions = diffStat(oldData, newData)
+		}
+	}
+
+	if options.Diffstat && len(decisions) > 0 {
+		entries := []diffStatEntry{}
+		for _, decision := range decisions {
+			entries = append(entries, diffStatEntry{path: decision.Path, insertions: decision.Insertions, deletions: decision.Deletions, binary: decision.Binary})
+		}
+		fmt.Println()
+		fmt.Print(formatDiffStat(entries))
+	}
+	return decisions, nil
+}
+
+// 合併來源branch到目標branch，回傳每個有變動的檔案的處理方式
+// 以兩個branch最近的共同祖先為基底進行三方合併，只有一邊修改的內容自動採用，兩邊修改到相同的行時依合併策略處理；
+// 沒有未解決的衝突時直接提交合併版本，否則以衝突標記寫入工作區並記錄合併狀態，待解決衝突後以merge --continue提交
+// 目標branch是來源branch的祖先時，依options.FastForward快轉目標branch而不建立合併版本
+// options.DryRun時只列出每個檔案的處理方式，不寫入版本、暫存區與工作區
+func (v *VCS) Merge(targetBranch, sourceBranch string, options MergeOptions) ([]MergeDecision, error) {
+	err21 := options.validate()
+	if err21 != nil {
+		return nil, err21
+	}
+
+	// 預覽不會修改儲存庫，不需要取得鎖；取得鎖後才讀取狀態，其他程序的提交不會在讀取後改變目前版本
+	if !options.DryRun {
+		if err := v.lock(); err != nil {
+			return nil, err
+		}
+		defer v.unlock()
+	}
+
+	// 從檔案讀取currentBranch與目前版本
+	err1 := v.loadState()
+	if err1 != nil {
+		return nil, err1
+	}
+
+	// 目標branch或來源branch不存在，則傳回錯誤
+	if !v.branchExists(targetBranch) {
+		return nil, fmt.Errorf("target branch %s does not exist", targetBranch)
+	}
+	// 來源可以是branch或任何版本表示式，例如tag或feature~1
+	sourceHead, err5 := v.resolveMergeRevision(sourceBranch)
+	if err5 != nil {
+		return nil, err5
+	}
+
+	// 合併後會覆蓋工作區，有尚未提交的變更時停止；預覽不會改變工作區，不需檢查
+	if !options.DryRun {
+		err2 := v.checkNoMergeInProgress()
+		if err2 != nil {
+			return nil, err2
+		}
+
+		statuses, err3 := v.collectStatus()
+		if err3 != nil {
+			return nil, err3
+		}
+		for _, status := range statuses {
+			if status.staged != statusUnmodified || status.unstaged != statusUnmodified {
+				return nil, fmt.Errorf("you have uncommitted changes in %s; commit them before merging", status.path)
+			}
+		}
+
+		// 合併會切換到目標branch，離開分離HEAD時提醒沒有在任何branch上的版本
+		if v.detached() {
+			err22 := v.warnIfUnreachable(v.currentCommit)
+			if err22 != nil {
+				return nil, err22
+			}
+		}
+	}
+
+	// 取得目標branch與來源branch的最新版本
+	targetHead, err4 := v.branchHead(targetBranch)
+	if err4 != nil {
+		return nil, err4
+	}
+
+	// 來源branch的版本都已包含在目標branch中
+	if sourceHead == nil {
+		fmt.Println("Already up to date.")
+		return nil, nil
+	}
+	if targetHead != nil {
+		merged, err6 := v.isAncestor(sourceHead.id, targetHead.id)
+		if err6 != nil {
+			return nil, err6
+		}
+		if merged {
+			fmt.Println("Already up to date.")
+			return nil, nil
+		}
+	}
+
+	targetManifest, err7 := v.recordManifest(targetHead)
+	if err7 != nil {
+		return nil, fmt.Errorf("failed to read target branch version file: %s", err7)
+	}
+
+	sourceManifest, err8 := v.recordManifest(sourceHead)
+	if err8 != nil {
+		return nil, fmt.Errorf("failed to read source branch version file: %s", err8)
+	}
+
+	// 目標branch沒有來源branch以外的新版本時，可以直接快轉
+	fastForward := targetHead == nil
+	if targetHead != nil {
+		var err22 error
+		if fastForward, err22 = v.isAncestor(targetHead.id, sourceHead.id); err22 != nil {
+			return nil, err22
+		}
+	}
+	if !fastForward && options.FastForward == FastForwardOnly {
+		return nil, fmt.Errorf("branches %s and %s have diverged; not possible to fast-forward", targetBranch, sourceBranch)
+	}
+	if fastForward && options.FastForward != NoFastForward && !options.DryRun {
+		return v.fastForward(targetBranch, sourceHead, targetManifest, sourceManifest)
+	}
+
+	// 以共同祖先作為三方合併的基底，沒有共同祖先時以空版本為基底
+	baseID := ""
+	baseManifest := manifest{}
+	if targetHead != nil {
+		var err9 error
+		if baseID, err9 = v.mergeBase(targetHead.id, sourceHead.id); err9 != nil {
+			return nil, err9
+		}
+		if baseID != "" {
+			baseRecord, err10 := v.findCommit(baseID)
+			if err10 != nil {
+				return nil, err10
+			}
+			if baseManifest, err10 = readManifest(baseRecord.directory); err10 != nil {
+				return nil, err10
+			}
+		}
+	}
+
+	mergeManifest, decisions, err11 := v.mergeManifests(baseManifest, targetManifest, sourceManifest, targetBranch, sourceBranch, options)
+	if err11 != nil {
+		return nil, err11
+	}
+
+	if options.DryRun {
+		method := "a merge version"
+		if fastForward && options.FastForward != NoFastForward {
+			method = "a fast-forward"
+		}
+		fmt.Printf("Merging %s into %s would create %s:\n", sourceBranch, targetBranch, method)
+		return v.previewMerge(decisions, targetManifest, options)
+	}
+	conflicts := []MergeDecision{}
+	for _, decision := range decisions {
+		switch decision.Action {
+		case MergeAutoMerged:
+			fmt.Printf("Auto-merging %s\n", decision.Path)
+		case MergeResolved:
+			fmt.Printf("Auto-merging %s (conflicts resolved using %s)\n", decision.Path, decision.Strategy)
+		case MergeConflict:
+			conflicts = append(conflicts, decision)
+		}
+	}
+
+	parents := []string{}
+	targetID := ""
+	if targetHead != nil {
+		targetID = targetHead.id
+		parents = append(parents, targetID)
+	}
+	parents = append(parents, sourceHead.id)
+	commitMessage := fmt.Sprintf("Merged %s into %s", sourceBranch, targetBranch)
+
+	// 先檢查工作區中會被覆蓋的未追蹤檔案，停止時不建立合併版本也不記錄合併狀態
+	plan, err19 := v.planSwitch(mergeManifest, targetBranch, CheckoutOptions{})
+	if err19 != nil {
+		return nil, err19
+	}
+
+	// 有衝突時先記錄合併狀態，保存合併前的暫存區與工作區以便放棄合併
+	if len(conflicts) > 0 {
+		state := mergeState{
+			Branch:       v.currentBranch,
+			Commit:       v.currentCommit,
+			Target:       targetBranch,
+			Source:       sourceBranch,
+			TargetCommit: targetID,
+			SourceCommit: sourceHead.id,
+			Base:         baseID,
+			Message:      commitMessage,
+			Merged:       mergeManifest,
+		}
+		var err12 error
+		if state.StagedFiles, state.WorkingFiles, err12 = v.saveWorkingState(); err12 != nil {
+			return nil, err12
+		}
+		for _, conflict := range conflicts {
+			state.Unresolved = append(state.Unresolved, conflict.Path)
+		}
+		err13 := v.writeMergeState(state)
+		if err13 != nil {
+			return nil, err13
+		}
+
+		// 切換到目標branch，將含有衝突標記的合併結果寫入工作區與暫存區
+		v.currentBranch = targetBranch
+		v.currentCommit = targetID
+		err14 := v.writeCurrentBranch()
+		if err14 != nil {
+			return nil, err14
+		}
+		err15 := v.writeCurrentCommit()
+		if err15 != nil {
+			return nil, err15
+		}
+		// 合併結果沒有的已追蹤檔案（例如來源branch刪除的檔案）也從工作區刪除
+		err16 := v.applySwitch(plan)
+		if err16 != nil {
+			return nil, err16
+		}
+
+		for _, conflict := range conflicts {
+			fmt.Printf("CONFLICT (%s)\n", conflict.Detail)
+		}
+		fmt.Println("Automatic merge failed; fix the conflicts, mark them resolved with \"vcs add <file>\", then run \"vcs merge --continue\".")
+		return decisions, nil
+	}
+
+	// 合併完成，寫入版本清單與提交資訊，兩個branch的最新版本都是父版本
+	_, err18 := v.createVersion(targetBranch, targetHead, mergeManifest, commitMessage, parents)
+	if err18 != nil {
+		return nil, err18
+	}
+
+	// 將合併結果寫入工作區與暫存區
+	err20 := v.applySwitch(plan)
+	if err20 != nil {
+		return nil, err20
+	}
+
+	// 提交合併後的版本
+	fmt.Printf("Successfully merged %s into %s\n", sourceBranch, targetBranch)
+	return decisions, nil
+}
@@ -0,0 +1,161 @@
+package vcs
+
+import (
+	"strings"
+	"testing"
+)
+
+// 將以|分隔的行轉換成含換行的行
+func mergeLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "|")
+	for i := range lines {
+		lines[i] += "\n"
+	}
+	return lines
+}
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		strategy           MergeStrategy
+		want               string
+		conflicts          int
+	}{
+		{
+			name: "no changes",
+			base: "a|b|c", ours: "a|b|c", theirs: "a|b|c",
+			want: "a|b|c",
+		},
+		{
+			name: "only ours changed",
+			base: "a|b|c", ours: "a|B|c", theirs: "a|b|c",
+			want: "a|B|c",
+		},
+		{
+			name: "only theirs changed",
+			base: "a|b|c", ours: "a|b|c", theirs: "a|b|C",
+			want: "a|b|C",
+		},
+		{
+			name: "separate changes",
+			base: "a|b|c|d|e", ours: "A|b|c|d|e", theirs: "a|b|c|d|E",
+			want: "A|b|c|d|E",
+		},
+		{
+			name: "same change on both sides",
+			base: "a|b|c", ours: "a|X|c", theirs: "a|X|c",
+			want: "a|X|c",
+		},
+		{
+			name: "insertions at different places",
+			base: "a|b|c|d", ours: "a|new1|b|c|d", theirs: "a|b|c|new2|d",
+			want: "a|new1|b|c|new2|d",
+		},
+		{
+			name: "deletion and separate edit",
+			base: "a|b|c|d|e", ours: "a|c|d|e", theirs: "a|b|c|d|E",
+			want: "a|c|d|E",
+		},
+		{
+			name: "adjacent edits conflict",
+			base: "a|b|c|d", ours: "a|B|c|d", theirs: "a|b|C|d",
+			want:      "a|<<<<<<< main|B|c|=======|b|C|>>>>>>> feature|d",
+			conflicts: 1,
+		},
+		{
+			name: "conflicting edit",
+			base: "a|b|c", ours: "a|ours|c", theirs: "a|theirs|c",
+			want:      "a|<<<<<<< main|ours|=======|theirs|>>>>>>> feature|c",
+			conflicts: 1,
+		},
+		{
+			name: "edit against deletion",
+			base: "a|b|c", ours: "a|B|c", theirs: "a|c",
+			want:      "a|<<<<<<< main|B|=======|>>>>>>> feature|c",
+			conflicts: 1,
+		},
+		{
+			name: "two conflicts",
+			base: "a|b|c|d|e", ours: "A1|b|c|d|E1", theirs: "A2|b|c|d|E2",
+			want:      "<<<<<<< main|A1|=======|A2|>>>>>>> feature|b|c|d|<<<<<<< main|E1|=======|E2|>>>>>>> feature",
+			conflicts: 2,
+		},
+		{
+			name: "ours strategy",
+			base: "a|b|c|d|e", ours: "a|ours|c|d|e", theirs: "a|theirs|c|d|E",
+			strategy: MergeOurs, want: "a|ours|c|d|E", conflicts: 1,
+		},
+		{
+			name: "theirs strategy",
+			base: "a|b|c|d|e", ours: "A|ours|c|d|e", theirs: "a|theirs|c|d|e",
+			strategy: MergeTheirs, want: "a|theirs|c|d|e", conflicts: 1,
+		},
+		{
+			name: "union strategy",
+			base: "a|b|c", ours: "a|ours|c", theirs: "a|theirs|c",
+			strategy: MergeUnion, want: "a|ours|theirs|c", conflicts: 1,
+		},
+		{
+			name: "strategy does not affect clean merges",
+			base: "a|b|c|d|e", ours: "A|b|c|d|e", theirs: "a|b|c|d|E",
+			strategy: MergeTheirs, want: "A|b|c|d|E",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			strategy := test.strategy
+			if strategy == "" {
+				strategy = MergeRecursive
+			}
+			got, conflicts := merge3(mergeLines(test.base), mergeLines(test.ours), mergeLines(test.theirs), "main", "feature", strategy)
+			if want := mergeLines(test.want); !sameLines(got, want) {
+				t.Fatalf("merge3 returned %q, want %q", strings.Join(got, ""), strings.Join(want, ""))
+			}
+			if conflicts != test.conflicts {
+				t.Fatalf("merge3 reported %d conflicts, want %d", conflicts, test.conflicts)
+			}
+		})
+	}
+}
+
+func TestMerge3MissingFinalNewline(t *testing.T) {
+	base := []string{"a\n", "b"}
+	ours := []string{"a\n", "ours"}
+	theirs := []string{"a\n", "theirs"}
+	got, conflicts := merge3(base, ours, theirs, "main", "feature", MergeRecursive)
+	want := "a\n<<<<<<< main\nours\n=======\ntheirs\n>>>>>>> feature\n"
+	if strings.Join(got, "") != want || conflicts != 1 {
+		t.Fatalf("merge3 returned %q with %d conflicts, want %q with 1", strings.Join(got, ""), conflicts, want)
+	}
+}
+
+func TestChangeHunks(t *testing.T) {
+	tests := []struct {
+		name        string
+		base, other string
+		want        []mergeHunk
+	}{
+		{"unchanged", "a|b", "a|b", []mergeHunk{}},
+		{"replace", "a|b|c", "a|B|c", []mergeHunk{{start: 1, end: 2, lines: mergeLines("B")}}},
+		{"insert", "a|c", "a|b|c", []mergeHunk{{start: 1, end: 1, lines: mergeLines("b")}}},
+		{"delete", "a|b|c", "a|c", []mergeHunk{{start: 1, end: 2}}},
+		{"two hunks", "a|b|c|d", "A|b|c|D", []mergeHunk{{start: 0, end: 1, lines: mergeLines("A")}, {start: 3, end: 4, lines: mergeLines("D")}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := changeHunks(mergeLines(test.base), mergeLines(test.other))
+			if len(got) != len(test.want) {
+				t.Fatalf("changeHunks returned %d hunks %v, want %v", len(got), got, test.want)
+			}
+			for i := range got {
+				if got[i].start != test.want[i].start || got[i].end != test.want[i].end || !sameLines(got[i].lines, test.want[i].lines) {
+					t.Fatalf("hunk %d is %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
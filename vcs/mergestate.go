@@ -0,0 +1,282 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 合併狀態的檔名，合併發生衝突時建立，完成或放棄合併後刪除
+const mergeStateFileName = "MERGE_STATE"
+
+// 進行中的合併
+type mergeState struct {
+	Branch       string   `json:"branch"`       // 合併前所在的branch
+	Commit       string   `json:"commit"`       // 合併前的目前版本
+	Target       string   `json:"target"`       // 目標branch
+	Source       string   `json:"source"`       // 來源branch
+	TargetCommit string   `json:"targetCommit"` // 目標branch合併時的最新版本
+	SourceCommit string   `json:"sourceCommit"` // 來源branch合併時的最新版本
+	Base         string   `json:"base"`         // 共同祖先，沒有共同祖先時為空
+	Message      string   `json:"message"`
+	Unresolved   []string `json:"unresolved"`   // 尚未解決衝突的檔案
+	Merged       manifest `json:"merged"`       // 寫入工作區的合併結果
+	StagedFiles  manifest `json:"stagedFiles"`  // 合併前的暫存區
+	WorkingFiles manifest `json:"workingFiles"` // 合併前的工作區
+}
+
+// 取得合併狀態檔案的路徑
+func (v *VCS) mergeStatePath() string {
+	return filepath.Join(v.repoDirectory, mergeStateFileName)
+}
+
+// 讀取合併狀態，沒有進行中的合併時回傳nil
+func (v *VCS) readMergeState() (*mergeState, error) {
+	data, err1 := os.ReadFile(v.mergeStatePath())
+	if os.IsNotExist(err1) {
+		return nil, nil
+	}
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to read merge state: %v", err1)
+	}
+
+	state := &mergeState{}
+	err2 := json.Unmarshal(data, state)
+	if err2 != nil {
+		return nil, fmt.Errorf("unable to decode merge state: %v", err2)
+	}
+	return state, nil
+}
+
+// 寫入合併狀態
+func (v *VCS) writeMergeState(state mergeState) error {
+	data, err1 := json.MarshalIndent(state, "", "  ")
+	if err1 != nil {
+		return fmt.Errorf("unable to encode merge state: %v", err1)
+	}
+	err2 := writeFileAtomic(v.mergeStatePath(), data)
+	if err2 != nil {
+		return fmt.Errorf("unable to write merge state: %v", err2)
+	}
+	return nil
+}
+
+// 合併進行中時傳回錯誤，避免其他操作改變合併的目標
+func (v *VCS) checkNoMergeInProgress() error {
+	state, err := v.readMergeState()
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		return fmt.Errorf("merging %s into %s is in progress; use \"vcs merge --continue\" or \"vcs merge --abort\"", state.Source, state.Target)
+	}
+	return nil
+}
+
+// 將路徑與其下的檔案標記為已解決衝突，沒有進行中的合併時不做任何事
+func (v *VCS) markResolved(paths ...string) error {
+	state, err1 := v.readMergeState()
+	if err1 != nil || state == nil {
+		return err1
+	}
+
+	unresolved := []string{}
+	for _, conflict := range state.Unresolved {
+		resolved := false
+		for _, path := range paths {
+			if path == "." || conflict == path || strings.HasPrefix(conflict, path+"/") {
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			unresolved = append(unresolved, conflict)
+		}
+	}
+	state.Unresolved = unresolved
+	return v.writeMergeState(*state)
+}
+
+// 將暫存區與工作區（未被忽略的檔案）存入物件庫，回傳兩者的清單
+func (v *VCS) saveWorkingState() (manifest, manifest, error) {
+	paths, err1 := v.stagedPaths()
+	if err1 != nil {
+		return nil, nil, err1
+	}
+	stagedFiles := manifest{}
+	for _, path := range paths {
+		data, err2 := readStagedFile(v.stagedPath(path))
+		if err2 != nil {
+			return nil, nil, err2
+		}
+		hash, err3 := v.writeObject(path, data, "")
+		if err3 != nil {
+			return nil, nil, err3
+		}
+		stagedFiles[path] = hash
+	}
+
+	workingFiles := manifest{}
+	saveWorkingFile := func(path string) error {
+		data, err := os.ReadFile(v.workingPath(path))
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		hash, err := v.writeObject(path, data, "")
+		if err != nil {
+			return err
+		}
+		workingFiles[path] = hash
+		return nil
+	}
+	err4 := v.walkWorkingTree(".", saveWorkingFile)
+	if err4 != nil {
+		return nil, nil, err4
+	}
+	// 已追蹤但符合.vcsignore的檔案也要保存
+	for _, path := range paths {
+		if _, saved := workingFiles[path]; saved {
+			continue
+		}
+		if info, err5 := os.Stat(v.workingPath(path)); err5 == nil && info.Mode().IsRegular() {
+			err6 := saveWorkingFile(path)
+			if err6 != nil {
+				return nil, nil, err6
+			}
+		}
+	}
+	return stagedFiles, workingFiles, nil
+}
+
+// 完成進行中的合併：所有衝突都已解決後，以暫存區內容建立合併版本
+func (v *VCS) MergeContinue() error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	state, err1 := v.readMergeState()
+	if err1 != nil {
+		return err1
+	}
+	if state == nil {
+		return fmt.Errorf("there is no merge in progress")
+	}
+	if len(state.Unresolved) > 0 {
+		return fmt.Errorf("unresolved conflicts in %s; fix them and mark them resolved with \"vcs add <file>\"", strings.Join(state.Unresolved, ", "))
+	}
+
+	// 目標branch在合併期間不應改變
+	targetID, err2 := v.readBranchHead(state.Target)
+	if err2 != nil {
+		return err2
+	}
+	if targetID != state.TargetCommit {
+		return fmt.Errorf("branch %s has moved since the merge started; run \"vcs merge --abort\"", state.Target)
+	}
+
+	var targetHead *commitRecord
+	parents := []string{}
+	if targetID != "" {
+		var err3 error
+		if targetHead, err3 = v.findCommit(targetID); err3 != nil {
+			return err3
+		}
+		parents = append(parents, targetID)
+	}
+	parents = append(parents, state.SourceCommit)
+
+	mergeManifest, err4 := v.stagedObjects(targetHead)
+	if err4 != nil {
+		return err4
+	}
+
+	id, err5 := v.createVersion(state.Target, targetHead, mergeManifest, state.Message, parents)
+	if err5 != nil {
+		return err5
+	}
+
+	err6 := os.Remove(v.mergeStatePath())
+	if err6 != nil {
+		return fmt.Errorf("unable to remove merge state: %v", err6)
+	}
+
+	fmt.Printf("Successfully merged %s into %s as version %d (%s)\n", state.Source, state.Target, v.currentVersion, shortID(id))
+	return nil
+}
+
+// 放棄進行中的合併，還原合併前的branch、暫存區與工作區
+func (v *VCS) MergeAbort() error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	state, err1 := v.readMergeState()
+	if err1 != nil {
+		return err1
+	}
+	if state == nil {
+		return fmt.Errorf("there is no merge in progress")
+	}
+
+	// 還原暫存區
+	err2 := clearFolder(v.filesDirectory)
+	if err2 != nil {
+		return err2
+	}
+	for _, path := range state.StagedFiles.paths() {
+		data, err3 := v.readObject(state.StagedFiles[path])
+		if err3 != nil {
+			return err3
+		}
+		err4 := writeStagedFile(v.stagedPath(path), data)
+		if err4 != nil {
+			return err4
+		}
+	}
+
+	// 刪除合併時新增到工作區的檔案，再還原合併前的工作區
+	for _, path := range state.Merged.paths() {
+		if _, existed := state.WorkingFiles[path]; existed {
+			continue
+		}
+		err5 := os.Remove(v.workingPath(path))
+		if err5 != nil && !os.IsNotExist(err5) {
+			return fmt.Errorf("unable to remove %s: %v", path, err5)
+		}
+		removeEmptyParents(filepath.Dir(v.workingPath(path)), v.workingDirectory)
+	}
+	for _, path := range state.WorkingFiles.paths() {
+		data, err6 := v.readObject(state.WorkingFiles[path])
+		if err6 != nil {
+			return err6
+		}
+		err7 := writeFileWithParents(v.workingPath(path), data)
+		if err7 != nil {
+			return fmt.Errorf("unable to restore %s: %v", path, err7)
+		}
+	}
+
+	// 還原合併前的branch與目前版本
+	v.currentBranch = state.Branch
+	v.currentCommit = state.Commit
+	err8 := v.writeCurrentBranch()
+	if err8 != nil {
+		return err8
+	}
+	err9 := v.writeCurrentCommit()
+	if err9 != nil {
+		return err9
+	}
+
+	err10 := os.Remove(v.mergeStatePath())
+	if err10 != nil {
+		return fmt.Errorf("unable to remove merge state: %v", err10)
+	}
+
+	fmt.Printf("Aborted merging %s into %s\n", state.Source, state.Target)
+	return nil
+}
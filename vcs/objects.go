@@ -0,0 +1,351 @@
+package vcs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 版本清單：記錄每個檔案路徑對應的內容雜湊值
+type manifest map[string]string
+
+// 版本清單的檔名
+const manifestFileName = "manifest.json"
+
+// 差異鏈的最大長度，超過就改存完整內容作為關鍵版本，限制還原時需要套用的差異數量
+const maxDeltaDepth = 10
+
+// 物件檔案開頭的標記
+const objectMagic = "vcsobj"
+
+// 物件的儲存方式
+const (
+	objectFull  = "full"  // 完整內容
+	objectDelta = "delta" // 相對於基底物件的差異
+)
+
+// 內容的壓縮方式
+const (
+	compressionNone = ""
+	compressionZlib = "zlib"
+)
+
+// 本身已經壓縮過的檔案類型，再壓縮一次幾乎沒有效果
+var compressedExtensions = map[string]bool{
+	".7z": true, ".avi": true, ".br": true, ".bz2": true, ".docx": true, ".gif": true,
+	".gz": true, ".heic": true, ".jar": true, ".jpeg": true, ".jpg": true, ".m4a": true,
+	".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".ogg": true, ".png": true,
+	".pptx": true, ".rar": true, ".tgz": true, ".webm": true, ".webp": true, ".xlsx": true,
+	".xz": true, ".zip": true, ".zst": true,
+}
+
+// 物件檔案的標頭，以一行key=value的文字記錄
+type objectHeader struct {
+	kind        string
+	base        string // 差異物件的基底雜湊值
+	depth       int    // 距離最近完整內容的差異數
+	compression string // 內容的壓縮方式
+}
+
+// 依檔名與內容判斷是否值得壓縮，圖片、影音與壓縮檔會略過
+func chooseCompression(name string, data []byte) string {
+	if compressedExtensions[strings.ToLower(filepath.Ext(name))] {
+		return compressionNone
+	}
+
+	contentType := http.DetectContentType(data)
+	if strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/") {
+		return compressionNone
+	}
+	switch contentType {
+	case "application/zip", "application/x-gzip", "application/x-rar-compressed", "application/wasm":
+		return compressionNone
+	}
+	return compressionZlib
+}
+
+// 將標頭與內容組成物件檔案，壓縮後沒有變小就改存原始內容
+func encodeObject(header objectHeader, payload []byte) ([]byte, error) {
+	if header.compression == compressionZlib {
+		var buffer bytes.Buffer
+		writer := zlib.NewWriter(&buffer)
+		if _, err1 := writer.Write(payload); err1 != nil {
+			return nil, fmt.Errorf("unable to compress object: %v", err1)
+		}
+		if err2 := writer.Close(); err2 != nil {
+			return nil, fmt.Errorf("unable to compress object: %v", err2)
+		}
+
+		if buffer.Len() < len(payload) {
+			payload = buffer.Bytes()
+		} else {
+			header.compression = compressionNone
+		}
+	}
+
+	fields := []string{objectMagic, "type=" + header.kind}
+	if header.kind == objectDelta {
+		fields = append(fields, "base="+header.base, "depth="+strconv.Itoa(header.depth))
+	}
+	if header.compression != compressionNone {
+		fields = append(fields, "compression="+header.compression)
+	}
+	data := []byte(strings.Join(fields, " ") + "\n")
+	return append(data, payload...), nil
+}
+
+// 解析物件檔案的標頭並解壓縮內容，沒有標頭的舊物件視為完整內容
+func decodeObject(data []byte) (objectHeader, []byte, error) {
+	header := objectHeader{kind: objectFull}
+	if !bytes.HasPrefix(data, []byte(objectMagic+" ")) {
+		return header, data, nil
+	}
+
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		return header, nil, fmt.Errorf("object header is not terminated")
+	}
+	for _, field := range strings.Fields(string(data[:end]))[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "type":
+			header.kind = value
+		case "base":
+			header.base = value
+		case "depth":
+			depth, err := strconv.Atoi(value)
+			if err != nil {
+				return header, nil, fmt.Errorf("invalid object depth %q", value)
+			}
+			header.depth = depth
+		case "compression":
+			header.compression = value
+		}
+	}
+	if header.kind == objectDelta && header.base == "" {
+		return header, nil, fmt.Errorf("delta object has no base")
+	}
+
+	payload := data[end+1:]
+	switch header.compression {
+	case compressionNone:
+		return header, payload, nil
+	case compressionZlib:
+		reader, err1 := zlib.NewReader(bytes.NewReader(payload))
+		if err1 != nil {
+			return header, nil, fmt.Errorf("unable to decompress object: %v", err1)
+		}
+		defer reader.Close()
+		decompressed, err2 := io.ReadAll(reader)
+		if err2 != nil {
+			return header, nil, fmt.Errorf("unable to decompress object: %v", err2)
+		}
+		return header, decompressed, nil
+	default:
+		return header, nil, fmt.Errorf("unknown compression %q", header.compression)
+	}
+}
+
+// 將檔案內容編碼成儲存格式，暫存區與物件庫共用
+func encodeStoredFile(name string, data []byte) ([]byte, error) {
+	return encodeObject(objectHeader{kind: objectFull, compression: chooseCompression(name, data)}, data)
+}
+
+// 從儲存格式還原檔案內容
+func decodeStoredFile(data []byte) ([]byte, error) {
+	header, payload, err := decodeObject(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.kind != objectFull {
+		return nil, fmt.Errorf("unexpected %s object in stored file", header.kind)
+	}
+	return payload, nil
+}
+
+// 計算內容的SHA-256雜湊值
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 取得物件在objects資料夾中的路徑，以雜湊值前兩碼分資料夾
+func (v *VCS) objectPath(hash string) string {
+	return filepath.Join(v.objectsDirectory, hash[:2], hash[2:])
+}
+
+// 將內容寫入物件庫，相同內容只會儲存一次
+// 若提供baseHash（例如同一檔案的上一個版本），會嘗試只儲存與基底的差異
+// name只用來判斷內容是否值得壓縮
+func (v *VCS) writeObject(name string, data []byte, baseHash string) (string, error) {
+	hash := hashBytes(data)
+	objectPath := v.objectPath(hash)
+
+	// 物件已存在（包含已打包的物件）就不需要再寫入
+	if v.objectExists(hash) {
+		return hash, nil
+	}
+
+	object, err5 := encodeStoredFile(name, data)
+	if err5 != nil {
+		return "", err5
+	}
+	if baseHash != "" && baseHash != hash {
+		deltaObject, err2 := v.encodeDeltaObject(name, data, baseHash)
+		if err2 != nil {
+			return "", err2
+		}
+		// 差異比完整內容小才使用
+		if deltaObject != nil && len(deltaObject) < len(object) {
+			object = deltaObject
+		}
+	}
+
+	err3 := os.MkdirAll(filepath.Dir(objectPath), os.ModePerm)
+	if err3 != nil {
+		return "", fmt.Errorf("unable to create object folder: %v", err3)
+	}
+
+	err4 := writeFileAtomic(objectPath, object)
+	if err4 != nil {
+		return "", fmt.Errorf("unable to write object %s: %v", hash, err4)
+	}
+	return hash, nil
+}
+
+// 產生相對於基底物件的差異物件，差異鏈已達上限時回傳nil，改存完整內容
+func (v *VCS) encodeDeltaObject(name string, data []byte, baseHash string) ([]byte, error) {
+	baseObject, err1 := v.readObjectFile(baseHash)
+	if err1 != nil {
+		return nil, err1
+	}
+	baseHeader, base, err2 := decodeObject(baseObject)
+	if err2 != nil {
+		return nil, fmt.Errorf("corrupt object %s: %v", baseHash, err2)
+	}
+
+	depth := 1
+	if baseHeader.kind == objectDelta {
+		depth = baseHeader.depth + 1
+		if depth > maxDeltaDepth {
+			return nil, nil
+		}
+
+		// 基底本身也是差異，需先還原成完整內容
+		var err3 error
+		base, err3 = v.readObject(baseHash)
+		if err3 != nil {
+			return nil, err3
+		}
+	}
+	header := objectHeader{kind: objectDelta, base: baseHash, depth: depth, compression: chooseCompression(name, data)}
+	return encodeObject(header, makeDelta(base, data))
+}
+
+// 從物件庫讀取內容，差異物件會沿著差異鏈還原成完整內容
+func (v *VCS) readObject(hash string) ([]byte, error) {
+	object, err1 := v.readObjectFile(hash)
+	if err1 != nil {
+		return nil, err1
+	}
+
+	header, payload, err2 := decodeObject(object)
+	if err2 != nil {
+		return nil, fmt.Errorf("corrupt object %s: %v", hash, err2)
+	}
+
+	switch header.kind {
+	case objectFull:
+		return payload, nil
+	case objectDelta:
+		base, err3 := v.readObject(header.base)
+		if err3 != nil {
+			return nil, err3
+		}
+		data, err4 := applyDelta(base, payload)
+		if err4 != nil {
+			return nil, fmt.Errorf("corrupt object %s: %v", hash, err4)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("corrupt object %s: unknown type %q", hash, header.kind)
+	}
+}
+
+// 讀取物件檔案原始內容
+func (v *VCS) readObjectFile(hash string) ([]byte, error) {
+	if len(hash) < 3 {
+		return nil, fmt.Errorf("invalid object hash: %q", hash)
+	}
+	data, err1 := os.ReadFile(v.objectPath(hash))
+	if err1 == nil {
+		return data, nil
+	}
+	if !os.IsNotExist(err1) {
+		return nil, fmt.Errorf("unable to read object %s: %v", hash, err1)
+	}
+
+	// 不在objects資料夾中時從打包檔讀取
+	packs, err2 := v.packedObjects()
+	if err2 != nil {
+		return nil, err2
+	}
+	object, found := packs[hash]
+	if !found {
+		return nil, fmt.Errorf("unable to read object %s: object does not exist", hash)
+	}
+	data, err3 := readPackedObject(object)
+	if err3 != nil {
+		return nil, fmt.Errorf("unable to read object %s from %s: %v", hash, filepath.Base(object.pack), err3)
+	}
+	return data, nil
+}
+
+// 將版本清單寫入版本資料夾，回傳清單內容的雜湊值
+func writeManifest(versionDirectory string, m manifest) (string, error) {
+	data, err1 := json.MarshalIndent(m, "", "  ")
+	if err1 != nil {
+		return "", fmt.Errorf("unable to encode manifest: %v", err1)
+	}
+
+	err2 := os.WriteFile(filepath.Join(versionDirectory, manifestFileName), data, 0644)
+	if err2 != nil {
+		return "", fmt.Errorf("unable to write manifest: %v", err2)
+	}
+	return hashBytes(data), nil
+}
+
+// 從版本資料夾讀取版本清單
+func readManifest(versionDirectory string) (manifest, error) {
+	data, err1 := os.ReadFile(filepath.Join(versionDirectory, manifestFileName))
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to read manifest: %v", err1)
+	}
+
+	m := manifest{}
+	err2 := json.Unmarshal(data, &m)
+	if err2 != nil {
+		return nil, fmt.Errorf("unable to decode manifest: %v", err2)
+	}
+	return m, nil
+}
+
+// 依路徑排序取得版本清單中的所有檔案
+func (m manifest) paths() []string {
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
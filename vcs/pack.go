@@ -0,0 +1,128 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 打包檔所在的資料夾，位於objects資料夾中
+const packFolderName = "pack"
+
+// 打包檔中一個物件的位置
+type packEntry struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// 已讀取索引的打包物件所在的打包檔與位置
+type packedObject struct {
+	pack  string // .pack檔案的路徑
+	entry packEntry
+}
+
+// 取得打包檔資料夾的路徑
+func (v *VCS) packDirectory() string {
+	return filepath.Join(v.objectsDirectory, packFolderName)
+}
+
+// 讀取所有打包檔的索引，以物件雜湊值為索引
+// 每個打包檔pack-<hash>.pack依序存放物件檔案的原始內容，同名的.idx以JSON記錄每個物件的位置與長度
+func (v *VCS) packedObjects() (map[string]packedObject, error) {
+	if v.packs != nil {
+		return v.packs, nil
+	}
+
+	packs := map[string]packedObject{}
+	indexPaths, err1 := filepath.Glob(filepath.Join(v.packDirectory(), "pack-*.idx"))
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to list pack files: %v", err1)
+	}
+	for _, indexPath := range indexPaths {
+		data, err2 := os.ReadFile(indexPath)
+		if err2 != nil {
+			return nil, fmt.Errorf("unable to read pack index %s: %v", filepath.Base(indexPath), err2)
+		}
+		index := map[string]packEntry{}
+		err3 := json.Unmarshal(data, &index)
+		if err3 != nil {
+			return nil, fmt.Errorf("unable to decode pack index %s: %v", filepath.Base(indexPath), err3)
+		}
+		packPath := strings.TrimSuffix(indexPath, ".idx") + ".pack"
+		for hash, entry := range index {
+			packs[hash] = packedObject{pack: packPath, entry: entry}
+		}
+	}
+
+	v.packs = packs
+	return packs, nil
+}
+
+// 從打包檔讀取物件檔案的原始內容
+func readPackedObject(object packedObject) ([]byte, error) {
+	file, err1 := os.Open(object.pack)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer file.Close()
+
+	data := make([]byte, object.entry.Length)
+	_, err2 := file.ReadAt(data, object.entry.Offset)
+	if err2 != nil && !(err2 == io.EOF && int64(len(data)) == object.entry.Length) {
+		return nil, err2
+	}
+	return data, nil
+}
+
+// 檢查物件是否存在於物件庫，包含已打包的物件
+func (v *VCS) objectExists(hash string) bool {
+	if len(hash) < 3 {
+		return false
+	}
+	if _, err := os.Stat(v.objectPath(hash)); err == nil {
+		return true
+	}
+	packs, err := v.packedObjects()
+	if err != nil {
+		return false
+	}
+	_, found := packs[hash]
+	return found
+}
+
+// 將物件寫成一個新的打包檔與索引，objects為雜湊值對應物件檔案的原始內容，回傳打包檔的名稱
+func (v *VCS) writePack(objects map[string][]byte) (string, error) {
+	hashes := make([]string, 0, len(objects))
+	for hash := range objects {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	packData := []byte{}
+	index := map[string]packEntry{}
+	for _, hash := range hashes {
+		index[hash] = packEntry{Offset: int64(len(packData)), Length: int64(len(objects[hash]))}
+		packData = append(packData, objects[hash]...)
+	}
+	indexData, err1 := json.MarshalIndent(index, "", "  ")
+	if err1 != nil {
+		return "", fmt.Errorf("unable to encode pack index: %v", err1)
+	}
+
+	// 先寫入打包檔再寫入索引，有索引的打包檔一定是完整的
+	name := "pack-" + hashBytes(packData)
+	err2 := writeFileAtomic(filepath.Join(v.packDirectory(), name+".pack"), packData)
+	if err2 != nil {
+		return "", fmt.Errorf("unable to write pack file: %v", err2)
+	}
+	err3 := writeFileAtomic(filepath.Join(v.packDirectory(), name+".idx"), indexData)
+	if err3 != nil {
+		return "", fmt.Errorf("unable to write pack index: %v", err3)
+	}
+	v.packs = nil
+	return name, nil
+}
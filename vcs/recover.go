@@ -0,0 +1,265 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 寫入中的暫存檔案與資料夾名稱的前綴與後綴，前綴為.所以不會與branch、tag或版本資料夾的名稱衝突
+const (
+	temporaryPrefix = "."
+	temporarySuffix = ".tmp"
+)
+
+// 進行中的提交記錄的檔名，提交在版本資料夾改名前建立，branch與目前版本都更新後刪除
+const pendingCommitFileName = "PENDING_COMMIT"
+
+// 進行中的提交，記錄完成提交所需的資訊
+type pendingCommit struct {
+	Branch  string `json:"branch"`  // 提交的branch，分離HEAD時為detachedHead
+	Version int    `json:"version"` // 新版本的編號
+	Commit  string `json:"commit"`  // 新版本的提交編號
+	Head    string `json:"head"`    // 提交前branch的最新版本
+	Current string `json:"current"` // 提交前的目前版本
+}
+
+// 取得進行中的提交記錄的路徑
+func (v *VCS) pendingCommitPath() string {
+	return filepath.Join(v.repoDirectory, pendingCommitFileName)
+}
+
+// 啟動時檢查是否有中斷的操作留下的檔案，並清理或完成它們：
+// 刪除寫入一半的暫存檔與未改名的暫存版本資料夾；已改名的版本資料夾一定是完整寫入的，
+// 即使之後損壞也不刪除，留給fsck回報；
+// 只依提交留下的記錄完成中斷的提交，不從版本資料夾推測，刪除branch後留下的版本不會被當成中斷的提交
+func (v *VCS) Recover() error {
+	// 尚未初始化時不需檢查
+	if _, err := os.Stat(v.repoDirectory); os.IsNotExist(err) {
+		return nil
+	}
+
+	// 大多數時候沒有需要處理的內容，先不取得鎖檢查，只讀取的指令才不會與修改儲存庫的指令搶鎖
+	needed, err1 := v.needsRecovery()
+	if err1 != nil || !needed {
+		return err1
+	}
+
+	// 其他程序正在修改儲存庫時，暫存檔可能還在寫入中，不進行檢查
+	acquired, _, err2 := v.tryLock()
+	if err2 != nil || !acquired {
+		return err2
+	}
+	defer v.unlock()
+
+	// 寫入一半的指標檔案、記錄與物件
+	for _, directory := range v.temporaryFileDirectories() {
+		err3 := removeTemporaryFiles(directory)
+		if err3 != nil {
+			return err3
+		}
+	}
+
+	// 未改名的暫存版本資料夾
+	branchFolders, err4 := os.ReadDir(v.historyDirectory)
+	if err4 != nil {
+		return fmt.Errorf("unable to read history folder: %v", err4)
+	}
+	for _, branchFolder := range branchFolders {
+		if !branchFolder.IsDir() {
+			continue
+		}
+		err5 := v.removeTemporaryVersions(branchFolder.Name())
+		if err5 != nil {
+			return err5
+		}
+	}
+	v.commits = nil
+
+	// 提交中斷時留下的記錄
+	return v.finishPendingCommit()
+}
+
+// 檢查是否有中斷的操作需要處理，只讀取不修改
+func (v *VCS) needsRecovery() (bool, error) {
+	for _, directory := range v.temporaryFileDirectories() {
+		entries, _ := os.ReadDir(directory)
+		for _, entry := range entries {
+			if !entry.IsDir() && isTemporaryFile(entry.Name()) {
+				return true, nil
+			}
+		}
+	}
+
+	branchFolders, err1 := os.ReadDir(v.historyDirectory)
+	if err1 != nil {
+		return false, fmt.Errorf("unable to read history folder: %v", err1)
+	}
+	for _, branchFolder := range branchFolders {
+		if !branchFolder.IsDir() {
+			continue
+		}
+		versionFolders, _ := os.ReadDir(filepath.Join(v.historyDirectory, branchFolder.Name()))
+		for _, versionFolder := range versionFolders {
+			if versionFolder.IsDir() && strings.HasPrefix(versionFolder.Name(), temporaryPrefix+"version_") {
+				return true, nil
+			}
+		}
+	}
+
+	_, err2 := os.Stat(v.pendingCommitPath())
+	return err2 == nil, nil
+}
+
+// 可能留有寫入一半的暫存檔的資料夾
+func (v *VCS) temporaryFileDirectories() []string {
+	logsDirectory := filepath.Join(v.repoDirectory, logsFolderName)
+	directories := []string{v.repoDirectory, filepath.Join(v.refsDirectory, "heads"), filepath.Join(v.refsDirectory, "tags"), logsDirectory, filepath.Join(logsDirectory, "refs", "heads")}
+	objectFolders, _ := os.ReadDir(v.objectsDirectory)
+	for _, folder := range objectFolders {
+		if folder.IsDir() {
+			directories = append(directories, filepath.Join(v.objectsDirectory, folder.Name()))
+		}
+	}
+	return directories
+}
+
+// 檔名是否為寫入中的暫存檔
+func isTemporaryFile(name string) bool {
+	return strings.HasPrefix(name, temporaryPrefix) && strings.HasSuffix(name, temporarySuffix)
+}
+
+// 刪除資料夾中寫入一半的暫存檔
+func removeTemporaryFiles(directory string) error {
+	entries, err1 := os.ReadDir(directory)
+	if os.IsNotExist(err1) {
+		return nil
+	}
+	if err1 != nil {
+		return fmt.Errorf("unable to read folder: %v", err1)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isTemporaryFile(name) {
+			continue
+		}
+		err2 := os.Remove(filepath.Join(directory, name))
+		if err2 != nil {
+			return fmt.Errorf("unable to remove %s: %v", name, err2)
+		}
+		fmt.Printf("Recovered: removed incomplete file %s\n", filepath.Join(directory, name))
+	}
+	return nil
+}
+
+// 刪除branch資料夾中未完成的暫存版本資料夾
+func (v *VCS) removeTemporaryVersions(folder string) error {
+	branchDirectory := filepath.Join(v.historyDirectory, folder)
+	versionFolders, err1 := os.ReadDir(branchDirectory)
+	if err1 != nil {
+		return fmt.Errorf("unable to read folder: %v", err1)
+	}
+
+	for _, versionFolder := range versionFolders {
+		name := versionFolder.Name()
+		if !versionFolder.IsDir() || !strings.HasPrefix(name, temporaryPrefix+"version_") {
+			continue
+		}
+		err2 := os.RemoveAll(filepath.Join(branchDirectory, name))
+		if err2 != nil {
+			return fmt.Errorf("unable to remove incomplete version %s/%s: %v", folder, name, err2)
+		}
+		fmt.Printf("Recovered: removed incomplete version %s/%s\n", folder, name)
+	}
+	return nil
+}
+
+// 讀取進行中的提交記錄，沒有進行中的提交時回傳nil
+func (v *VCS) readPendingCommit() (*pendingCommit, error) {
+	data, err1 := os.ReadFile(v.pendingCommitPath())
+	if os.IsNotExist(err1) {
+		return nil, nil
+	}
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to read pending commit: %v", err1)
+	}
+
+	pending := &pendingCommit{}
+	err2 := json.Unmarshal(data, pending)
+	if err2 != nil {
+		return nil, fmt.Errorf("unable to decode pending commit: %v", err2)
+	}
+	return pending, nil
+}
+
+// 寫入進行中的提交記錄
+func (v *VCS) writePendingCommit(pending pendingCommit) error {
+	data, err1 := json.MarshalIndent(pending, "", "  ")
+	if err1 != nil {
+		return fmt.Errorf("unable to encode pending commit: %v", err1)
+	}
+	err2 := writeFileAtomic(v.pendingCommitPath(), data)
+	if err2 != nil {
+		return fmt.Errorf("unable to write pending commit: %v", err2)
+	}
+	return nil
+}
+
+// 刪除進行中的提交記錄
+func (v *VCS) removePendingCommit() error {
+	err := os.Remove(v.pendingCommitPath())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove pending commit: %v", err)
+	}
+	return nil
+}
+
+// 完成中斷的提交：版本資料夾已改名完成時，將尚未更新的branch與目前版本指向它；
+// 版本資料夾尚未改名時，暫存資料夾已被刪除，只需刪除記錄
+func (v *VCS) finishPendingCommit() error {
+	pending, err1 := v.readPendingCommit()
+	if err1 != nil || pending == nil {
+		return err1
+	}
+
+	folder := pending.Branch
+	if folder == detachedHead {
+		folder = detachedFolder
+	}
+	versionDirectory := filepath.Join(v.historyDirectory, folder, fmt.Sprintf("version_%d", pending.Version))
+	_, id, err2 := readCommitInfo(versionDirectory)
+	if err2 == nil && id == pending.Commit {
+		err3 := v.readCurrentCommit()
+		if err3 != nil {
+			return err3
+		}
+		if pending.Branch != detachedHead && v.branchExists(pending.Branch) {
+			head, err4 := v.readBranchHead(pending.Branch)
+			if err4 != nil {
+				return err4
+			}
+			if head == pending.Head {
+				err5 := v.writeBranchHead(pending.Branch, pending.Commit)
+				if err5 != nil {
+					return err5
+				}
+			}
+		}
+		if v.currentCommit == pending.Current {
+			v.currentBranch = pending.Branch
+			v.currentCommit = pending.Commit
+			err6 := v.writeCurrentBranch()
+			if err6 != nil {
+				return err6
+			}
+			err7 := v.writeCurrentCommit()
+			if err7 != nil {
+				return err7
+			}
+		}
+		fmt.Printf("Recovered: finished interrupted commit of %s@%d (%s)\n", folder, pending.Version, shortID(pending.Commit))
+	}
+	return v.removePendingCommit()
+}
@@ -0,0 +1,137 @@
+package vcs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 建立有main@1與main@2兩個版本的測試用儲存庫
+func newRecoverTestRepo(t *testing.T) (*VCS, func(path, content, message string)) {
+	t.Helper()
+	root := t.TempDir()
+	v := NewVCSAt(root)
+	commit := func(path, content, message string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Add(filepath.Join(root, path)); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+	commit("a.txt", "one\n", "first")
+	commit("a.txt", "one\ntwo\n", "second")
+	return v, commit
+}
+
+// 讀取branch與目前版本的指標
+func readPointers(t *testing.T, v *VCS, branch string) (head, current string) {
+	t.Helper()
+	head, err1 := v.readBranchHead(branch)
+	if err1 != nil {
+		t.Fatal(err1)
+	}
+	if err2 := v.readCurrentCommit(); err2 != nil {
+		t.Fatal(err2)
+	}
+	return head, v.currentCommit
+}
+
+func TestRecoverIgnoresDeletedBranchVersions(t *testing.T) {
+	v, commit := newRecoverTestRepo(t)
+	if err := v.CreateBranch("feature", "", true); err != nil {
+		t.Fatal(err)
+	}
+	commit("b.txt", "feature\n", "feature work")
+	if err := v.CheckoutBranch("main", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.DeleteBranch("feature", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新建立的feature與留下的feature@3有相同的父版本
+	if err := v.CreateBranch("feature", "main", false); err != nil {
+		t.Fatal(err)
+	}
+	head, current := readPointers(t, v, "feature")
+
+	if err := v.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	gotHead, gotCurrent := readPointers(t, v, "feature")
+	if gotHead != head || gotCurrent != current {
+		t.Fatalf("Recover moved feature to %s and the current version to %s, want %s and %s", shortID(gotHead), shortID(gotCurrent), shortID(head), shortID(current))
+	}
+}
+
+func TestRecoverFinishesPendingCommit(t *testing.T) {
+	v, _ := newRecoverTestRepo(t)
+	if err := v.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	record, err1 := v.branchHead("main")
+	if err1 != nil {
+		t.Fatal(err1)
+	}
+	parent := record.info.Parents[0]
+
+	// 模擬版本資料夾改名後、更新branch與目前版本前中斷的提交
+	if err := writeFileAtomic(v.branchRefPath("main"), []byte(parent)); err != nil {
+		t.Fatal(err)
+	}
+	v.currentCommit = parent
+	if err := v.writeCurrentCommit(); err != nil {
+		t.Fatal(err)
+	}
+	pending := pendingCommit{Branch: "main", Version: 2, Commit: record.id, Head: parent, Current: parent}
+	if err := v.writePendingCommit(pending); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	head, current := readPointers(t, v, "main")
+	if head != record.id || current != record.id {
+		t.Fatalf("after Recover main is %s and the current version is %s, want both at %s", shortID(head), shortID(current), shortID(record.id))
+	}
+	if _, err := os.Stat(v.pendingCommitPath()); !os.IsNotExist(err) {
+		t.Fatalf("Recover left %s behind", pendingCommitFileName)
+	}
+}
+
+func TestRecoverDiscardsUnpublishedCommit(t *testing.T) {
+	v, _ := newRecoverTestRepo(t)
+	head, current := readPointers(t, v, "main")
+
+	// 模擬版本資料夾改名前中斷的提交
+	temporaryDirectory := filepath.Join(v.historyDirectory, "main", temporaryPrefix+"version_3-123")
+	if err := os.MkdirAll(temporaryDirectory, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	pending := pendingCommit{Branch: "main", Version: 3, Commit: "0123456789abcdef", Head: head, Current: current}
+	if err := v.writePendingCommit(pending); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	gotHead, gotCurrent := readPointers(t, v, "main")
+	if gotHead != head || gotCurrent != current {
+		t.Fatalf("Recover moved main to %s and the current version to %s, want them unchanged", shortID(gotHead), shortID(gotCurrent))
+	}
+	for _, path := range []string{temporaryDirectory, v.pendingCommitPath()} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("Recover left %s behind", path)
+		}
+	}
+}
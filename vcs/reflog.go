@@ -0,0 +1,163 @@
+package vcs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 版本指標移動的記錄放在.vcs/logs中：HEAD記錄目前版本，refs/heads/<branch>記錄branch
+// 每行為「舊提交編號 新提交編號 Unix時間」，沒有版本時以nullCommit表示
+const logsFolderName = "logs"
+
+// 記錄中代表沒有版本的提交編號
+var nullCommit = strings.Repeat("0", 64)
+
+// 記錄保留的天數，超過的項目在gc時刪除
+const reflogExpireDays = 90
+
+// 一筆版本指標移動的記錄
+type reflogEntry struct {
+	old       string
+	new       string
+	timestamp time.Time
+}
+
+// 取得目前版本的記錄檔路徑
+func (v *VCS) headReflogPath() string {
+	return filepath.Join(v.repoDirectory, logsFolderName, "HEAD")
+}
+
+// 取得branch的記錄檔路徑
+func (v *VCS) branchReflogPath(branch string) string {
+	return filepath.Join(v.repoDirectory, logsFolderName, "refs", "heads", branch)
+}
+
+// 記錄檔中的一行
+func (entry reflogEntry) String() string {
+	oldID, newID := entry.old, entry.new
+	if oldID == "" {
+		oldID = nullCommit
+	}
+	if newID == "" {
+		newID = nullCommit
+	}
+	return fmt.Sprintf("%s %s %d\n", oldID, newID, entry.timestamp.Unix())
+}
+
+// 在記錄檔加入一筆指標移動，新舊相同時不記錄
+func appendReflog(logPath, oldID, newID string) error {
+	if oldID == newID {
+		return nil
+	}
+
+	err1 := os.MkdirAll(filepath.Dir(logPath), os.ModePerm)
+	if err1 != nil {
+		return fmt.Errorf("unable to create logs folder: %v", err1)
+	}
+	file, err2 := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err2 != nil {
+		return fmt.Errorf("unable to open %s: %v", logPath, err2)
+	}
+	defer file.Close()
+	_, err3 := file.WriteString(reflogEntry{old: oldID, new: newID, timestamp: time.Now()}.String())
+	if err3 != nil {
+		return fmt.Errorf("unable to write %s: %v", logPath, err3)
+	}
+	return nil
+}
+
+// 讀取記錄檔，檔案不存在時回傳空的記錄，無法解析的行會略過
+func readReflog(logPath string) ([]reflogEntry, error) {
+	file, err1 := os.Open(logPath)
+	if os.IsNotExist(err1) {
+		return nil, nil
+	}
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", logPath, err1)
+	}
+	defer file.Close()
+
+	entries := []reflogEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		seconds, err2 := strconv.ParseInt(fields[2], 10, 64)
+		if err2 != nil {
+			continue
+		}
+		entry := reflogEntry{old: fields[0], new: fields[1], timestamp: time.Unix(seconds, 0)}
+		if entry.old == nullCommit {
+			entry.old = ""
+		}
+		if entry.new == nullCommit {
+			entry.new = ""
+		}
+		entries = append(entries, entry)
+	}
+	err3 := scanner.Err()
+	if err3 != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", logPath, err3)
+	}
+	return entries, nil
+}
+
+// 列出所有記錄檔的路徑
+func (v *VCS) reflogPaths() ([]string, error) {
+	paths := []string{}
+	logsDirectory := filepath.Join(v.repoDirectory, logsFolderName)
+	err := filepath.WalkDir(logsDirectory, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), temporaryPrefix) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read logs folder: %v", err)
+	}
+	return paths, nil
+}
+
+// 刪除所有記錄檔中早於cutoff的項目，回傳刪除的筆數
+func (v *VCS) expireReflogs(cutoff time.Time) (int, error) {
+	paths, err1 := v.reflogPaths()
+	if err1 != nil {
+		return 0, err1
+	}
+
+	expired := 0
+	for _, logPath := range paths {
+		entries, err2 := readReflog(logPath)
+		if err2 != nil {
+			return expired, err2
+		}
+		var builder strings.Builder
+		kept := 0
+		for _, entry := range entries {
+			if entry.timestamp.Before(cutoff) {
+				continue
+			}
+			kept++
+			builder.WriteString(entry.String())
+		}
+		if kept == len(entries) {
+			continue
+		}
+		expired += len(entries) - kept
+		err3 := writeFileAtomic(logPath, []byte(builder.String()))
+		if err3 != nil {
+			return expired, fmt.Errorf("unable to write %s: %v", logPath, err3)
+		}
+	}
+	return expired, nil
+}
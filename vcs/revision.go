@@ -0,0 +1,314 @@
+package vcs
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 以提交編號前綴指定版本時，前綴的最短長度
+const minimumPrefixLength = 4
+
+// 解析版本表示式，回傳對應的版本
+// 支援的寫法：
+//
+//	HEAD、@             目前版本
+//	3                   目前branch的版本編號
+//	feature@3           指定branch的版本編號
+//	detached@3          分離HEAD時提交的版本編號
+//	feature、v1.0       branch或tag指向的版本
+//	1a2b3c4d            提交編號（至少4個字元的前綴）
+//	@{yesterday}        目前branch在指定時間的版本，也可寫成feature@{2 days ago}、main@{2024-05-01}
+//	<rev>~2、<rev>^、<rev>^2  往回第2個第一父版本、第一父版本、第二父版本
+func (v *VCS) resolveRevision(expression string) (*commitRecord, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("empty revision")
+	}
+
+	// 分開基底與~、^後綴，@{...}中的字元不視為後綴
+	baseEnd := len(expression)
+	depth := 0
+	for i, c := range expression {
+		if c == '{' {
+			depth++
+		} else if c == '}' {
+			depth--
+		} else if depth == 0 && (c == '~' || c == '^') {
+			baseEnd = i
+			break
+		}
+	}
+
+	record, err1 := v.resolveRevisionBase(expression[:baseEnd])
+	if err1 != nil {
+		return nil, err1
+	}
+
+	suffix := expression[baseEnd:]
+	for suffix != "" {
+		// 後綴只能由~、^與其後的數字組成
+		operator := suffix[0]
+		if operator != '~' && operator != '^' {
+			return nil, fmt.Errorf("revision %q: unexpected %q after %s", expression, suffix, expression[:len(expression)-len(suffix)])
+		}
+		suffix = suffix[1:]
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		count := 1
+		if digits > 0 {
+			var err2 error
+			count, err2 = strconv.Atoi(suffix[:digits])
+			if err2 != nil {
+				return nil, fmt.Errorf("revision %q: invalid count %s: %v", expression, suffix[:digits], err2)
+			}
+		}
+		suffix = suffix[digits:]
+
+		var err3 error
+		if operator == '~' {
+			// ~N：沿著第一父版本往回N次
+			for i := 0; i < count && err3 == nil; i++ {
+				record, err3 = v.parentOf(record, 1, expression)
+			}
+		} else if count > 0 {
+			// ^N：第N個父版本，^0為版本本身
+			record, err3 = v.parentOf(record, count, expression)
+		}
+		if err3 != nil {
+			return nil, err3
+		}
+	}
+	return record, nil
+}
+
+// 解析merge與merge-base的參數：branch名稱取branch的最新版本（branch尚無版本時回傳nil），
+// 與tag同名時也以branch為準；其他寫法以版本表示式解析
+func (v *VCS) resolveMergeRevision(expression string) (*commitRecord, error) {
+	if v.branchExists(expression) {
+		return v.branchHead(expression)
+	}
+	return v.resolveRevision(expression)
+}
+
+// 取得版本的第n個父版本
+func (v *VCS) parentOf(record *commitRecord, n int, expression string) (*commitRecord, error) {
+	if n > len(record.info.Parents) {
+		if len(record.info.Parents) == 0 {
+			return nil, fmt.Errorf("revision %q: version %s has no parent", expression, record.label())
+		}
+		return nil, fmt.Errorf("revision %q: version %s has only %d parent(s)", expression, record.label(), len(record.info.Parents))
+	}
+	return v.findCommit(record.info.Parents[n-1])
+}
+
+// 解析不含~、^後綴的版本表示式
+func (v *VCS) resolveRevisionBase(expression string) (*commitRecord, error) {
+	// HEAD或@代表目前版本
+	if expression == "HEAD" || expression == "@" {
+		record, err1 := v.currentRecord()
+		if err1 != nil {
+			return nil, err1
+		}
+		if record == nil {
+			return nil, fmt.Errorf("revision %q: there are no commits yet", expression)
+		}
+		return record, nil
+	}
+
+	// <branch>@<version>或<branch>@{<date>}，省略branch時為目前branch
+	if name, selector, found := strings.Cut(expression, "@"); found {
+		if name == "" || name == "HEAD" {
+			name = v.currentBranch
+		}
+		if name == detachedHead {
+			return nil, fmt.Errorf("revision %q: HEAD is detached; specify a branch name", expression)
+		}
+		// detached@<version>為分離HEAD時提交的版本，沒有同名branch時才適用
+		if name == "detached" && !v.branchExists(name) && !strings.HasPrefix(selector, "{") {
+			version, err11 := strconv.Atoi(selector)
+			if err11 != nil || version < 1 {
+				return nil, fmt.Errorf("revision %q: invalid version number %q", expression, selector)
+			}
+			return v.findVersion(detachedFolder, version)
+		}
+		if !v.branchExists(name) {
+			return nil, fmt.Errorf("revision %q: branch %s does not exist", expression, name)
+		}
+		if strings.HasPrefix(selector, "{") && strings.HasSuffix(selector, "}") {
+			moment, err2 := parseRevisionDate(selector[1 : len(selector)-1])
+			if err2 != nil {
+				return nil, fmt.Errorf("revision %q: %v", expression, err2)
+			}
+			return v.versionAtTime(name, moment, expression)
+		}
+		version, err3 := strconv.Atoi(selector)
+		if err3 != nil || version < 1 {
+			return nil, fmt.Errorf("revision %q: invalid version number %q", expression, selector)
+		}
+		return v.findVersion(name, version)
+	}
+
+	// 純數字為目前branch的版本編號，分離HEAD時為目前版本所在資料夾的版本編號；夠長的數字也可能是提交編號前綴
+	candidates := []string{}
+	var found *commitRecord
+	if version, err4 := strconv.Atoi(expression); err4 == nil && version > 0 {
+		branch := v.currentBranch
+		if v.detached() {
+			if current, err10 := v.currentRecord(); err10 == nil && current != nil {
+				branch = current.branch
+			}
+		}
+		if record, err5 := v.findVersion(branch, version); err5 == nil {
+			found = record
+			candidates = append(candidates, fmt.Sprintf("version %s", record.label()))
+		} else if len(expression) < minimumPrefixLength {
+			return nil, fmt.Errorf("revision %q: %v", expression, err5)
+		}
+	}
+
+	// branch與tag名稱
+	if v.branchExists(expression) {
+		record, err6 := v.branchHead(expression)
+		if err6 != nil {
+			return nil, err6
+		}
+		if record == nil {
+			return nil, fmt.Errorf("revision %q: branch %s has no commits yet", expression, expression)
+		}
+		found = record
+		candidates = append(candidates, "branch "+expression)
+	}
+	if id, exists, err7 := v.readTag(expression); err7 != nil {
+		return nil, err7
+	} else if exists {
+		record, err8 := v.findCommit(id)
+		if err8 != nil {
+			return nil, fmt.Errorf("revision %q: tag points to a missing version: %v", expression, err8)
+		}
+		found = record
+		candidates = append(candidates, "tag "+expression)
+	}
+
+	// 提交編號前綴
+	if len(expression) >= minimumPrefixLength && isHex(expression) {
+		matches, err9 := v.commitsWithPrefix(strings.ToLower(expression))
+		if err9 != nil {
+			return nil, err9
+		}
+		if len(matches) > 1 {
+			ids := []string{}
+			for _, match := range matches {
+				ids = append(ids, fmt.Sprintf("%s (%s)", shortID(match.id), match.label()))
+			}
+			return nil, fmt.Errorf("revision %q is ambiguous; it matches commits %s", expression, strings.Join(ids, ", "))
+		}
+		if len(matches) == 1 {
+			found = matches[0]
+			candidates = append(candidates, "commit "+shortID(found.id))
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("unknown revision %q", expression)
+	case len(candidates) > 1:
+		return nil, fmt.Errorf("revision %q is ambiguous; it could be %s", expression, strings.Join(candidates, " or "))
+	}
+	return found, nil
+}
+
+// 判斷字串是否只包含十六進位字元
+func isHex(text string) bool {
+	for _, c := range strings.ToLower(text) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// 找出提交編號以prefix開頭的版本
+func (v *VCS) commitsWithPrefix(prefix string) ([]*commitRecord, error) {
+	commits, err := v.loadCommits()
+	if err != nil {
+		return nil, err
+	}
+	matches := []*commitRecord{}
+	for id, record := range commits {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, record)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].id < matches[j].id })
+	return matches, nil
+}
+
+// 取得branch在指定時間的版本：沿著第一父版本往回，找出第一個在該時間之前提交的版本
+func (v *VCS) versionAtTime(branch string, moment time.Time, expression string) (*commitRecord, error) {
+	record, err1 := v.branchHead(branch)
+	if err1 != nil {
+		return nil, err1
+	}
+	for record != nil {
+		if !record.info.Timestamp.After(moment) {
+			return record, nil
+		}
+		if len(record.info.Parents) == 0 {
+			break
+		}
+		var err2 error
+		if record, err2 = v.findCommit(record.info.Parents[0]); err2 != nil {
+			return nil, err2
+		}
+	}
+	return nil, fmt.Errorf("revision %q: branch %s has no versions as of %s", expression, branch, moment.Format(time.RFC1123Z))
+}
+
+// 解析@{...}中的時間：now、today、yesterday、<n> <unit> ago，或是日期與時間
+func parseRevisionDate(text string) (time.Time, error) {
+	now := time.Now()
+	normalized := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(text, ".", " ")))
+	switch normalized {
+	case "now":
+		return now, nil
+	case "today":
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	// <n> <unit> ago
+	fields := strings.Fields(normalized)
+	if len(fields) == 3 && fields[2] == "ago" {
+		count, err := strconv.Atoi(fields[0])
+		if err == nil && count >= 0 {
+			switch strings.TrimSuffix(fields[1], "s") {
+			case "second":
+				return now.Add(-time.Duration(count) * time.Second), nil
+			case "minute":
+				return now.Add(-time.Duration(count) * time.Minute), nil
+			case "hour":
+				return now.Add(-time.Duration(count) * time.Hour), nil
+			case "day":
+				return now.AddDate(0, 0, -count), nil
+			case "week":
+				return now.AddDate(0, 0, -7*count), nil
+			case "month":
+				return now.AddDate(0, -count, 0), nil
+			case "year":
+				return now.AddDate(-count, 0, 0), nil
+			}
+		}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if moment, err := time.ParseInLocation(layout, strings.TrimSpace(text), time.Local); err == nil {
+			return moment, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", text)
+}
@@ -0,0 +1,196 @@
+package vcs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 建立測試用的儲存庫：
+//
+//	main:    main@1 - main@2 - main@3 - main@4（合併feature）
+//	feature:           \- feature@3 -/
+//
+// tag v1指向main@1，tag feature與branch feature同名，tag 2與版本編號2相同
+func newRevisionTestRepo(t *testing.T) *VCS {
+	t.Helper()
+	root := t.TempDir()
+	v := NewVCSAt(root)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(path, content, message string) {
+		t.Helper()
+		must(os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+		must(v.Add(filepath.Join(root, path)))
+		must(v.Commit(message))
+	}
+
+	must(v.Init())
+	commit("a.txt", "one\n", "first")
+	commit("a.txt", "one\ntwo\n", "second")
+	must(v.CreateBranch("feature", "", true))
+	commit("b.txt", "feature\n", "feature work")
+	must(v.CheckoutBranch("main", CheckoutOptions{}))
+	commit("a.txt", "one\ntwo\nthree\n", "third")
+	_, err := v.Merge("main", "feature", MergeOptions{})
+	must(err)
+	must(v.CreateTag("v1", "main@1", "", false, false))
+	must(v.CreateTag("feature", "main@1", "", false, false))
+	must(v.CreateTag("2", "main@3", "", false, false))
+	must(v.loadState())
+	return v
+}
+
+func TestResolveRevision(t *testing.T) {
+	v := newRevisionTestRepo(t)
+	label := func(expression string) string {
+		t.Helper()
+		record, err := v.resolveRevision(expression)
+		if err != nil {
+			t.Fatalf("resolveRevision(%q): %v", expression, err)
+		}
+		return record.label()
+	}
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"HEAD", "main@4"},
+		{"@", "main@4"},
+		{"main", "main@4"},
+		{"3", "main@3"},
+		{"main@1", "main@1"},
+		{"feature@3", "feature@3"},
+		{"feature@2", "main@2"},
+		{"v1", "main@1"},
+		{"HEAD~1", "main@3"},
+		{"HEAD^", "main@3"},
+		{"HEAD^2", "feature@3"},
+		{"HEAD^0", "main@4"},
+		{"main~3", "main@1"},
+		{"HEAD^2~1", "main@2"},
+		{"main@3~2", "main@1"},
+		{"@{now}", "main@4"},
+		{"main@{now}", "main@4"},
+	}
+	for _, test := range tests {
+		if got := label(test.expression); got != test.want {
+			t.Errorf("resolveRevision(%q) = %s, want %s", test.expression, got, test.want)
+		}
+	}
+
+	// 提交編號與其前綴
+	head, _ := v.resolveRevision("HEAD")
+	for _, expression := range []string{head.id, head.id[:minimumPrefixLength], strings.ToUpper(head.id[:12])} {
+		if got := label(expression); got != "main@4" {
+			t.Errorf("resolveRevision(%q) = %s, want main@4", expression, got)
+		}
+	}
+}
+
+func TestResolveMergeRevision(t *testing.T) {
+	v := newRevisionTestRepo(t)
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"feature", "feature@3"},
+		{"v1", "main@1"},
+		{"HEAD^2~1", "main@2"},
+	}
+	for _, test := range tests {
+		record, err := v.resolveMergeRevision(test.expression)
+		if err != nil {
+			t.Errorf("resolveMergeRevision(%q): %v", test.expression, err)
+			continue
+		}
+		if record.label() != test.want {
+			t.Errorf("resolveMergeRevision(%q) = %s, want %s", test.expression, record.label(), test.want)
+		}
+	}
+}
+
+func TestResolveRevisionErrors(t *testing.T) {
+	v := newRevisionTestRepo(t)
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"", "empty revision"},
+		{"nope", "unknown revision"},
+		{"abcdef0123", "unknown revision"},
+		{"feature", "ambiguous"},
+		{"2", "ambiguous"},
+		{"9", "does not exist"},
+		{"main@9", "does not exist"},
+		{"main@0", "invalid version number"},
+		{"main@x", "invalid version number"},
+		{"nope@1", "branch nope does not exist"},
+		{"main~9", "has no parent"},
+		{"main^3", "has only 2 parent(s)"},
+		{"HEAD~x", "unexpected \"x\" after HEAD~"},
+		{"HEAD~1x", "unexpected \"x\" after HEAD~1"},
+		{"main^a", "unexpected \"a\" after main^"},
+		{"HEAD^99999999999999999999", "invalid count"},
+		{"main@{someday}", "unrecognized date"},
+		{"main@{1 year ago}", "has no versions as of"},
+	}
+	for _, test := range tests {
+		record, err := v.resolveRevision(test.expression)
+		if err == nil {
+			t.Errorf("resolveRevision(%q) = %s, want an error containing %q", test.expression, record.label(), test.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("resolveRevision(%q) error = %q, want it to contain %q", test.expression, err, test.want)
+		}
+	}
+}
+
+func TestParseRevisionDate(t *testing.T) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"now", now},
+		{"today", today},
+		{"yesterday", now.AddDate(0, 0, -1)},
+		{"30 seconds ago", now.Add(-30 * time.Second)},
+		{"1 minute ago", now.Add(-time.Minute)},
+		{"5 hours ago", now.Add(-5 * time.Hour)},
+		{"2 days ago", now.AddDate(0, 0, -2)},
+		{"2 weeks ago", now.AddDate(0, 0, -14)},
+		{"2.weeks.ago", now.AddDate(0, 0, -14)},
+		{"3 Months Ago", now.AddDate(0, -3, 0)},
+		{"1 year ago", now.AddDate(-1, 0, 0)},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+		{"2024-05-01 13:45", time.Date(2024, 5, 1, 13, 45, 0, 0, time.Local)},
+		{"2024-05-01 13:45:30", time.Date(2024, 5, 1, 13, 45, 30, 0, time.Local)},
+		{"2024-05-01T13:45:30Z", time.Date(2024, 5, 1, 13, 45, 30, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := parseRevisionDate(test.text)
+		if err != nil {
+			t.Errorf("parseRevisionDate(%q): %v", test.text, err)
+			continue
+		}
+		if difference := got.Sub(test.want); difference < -time.Minute || difference > time.Minute {
+			t.Errorf("parseRevisionDate(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+
+	for _, text := range []string{"", "someday", "-1 days ago", "2 fortnights ago", "2024-13-01"} {
+		if got, err := parseRevisionDate(text); err == nil {
+			t.Errorf("parseRevisionDate(%q) = %v, want an error", text, got)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// 檔案狀態代碼，與簡短格式輸出的字元相同
+const (
+	statusUnmodified byte = ' '
+	statusAdded      byte = 'A'
+	statusModified   byte = 'M'
+	statusDeleted    byte = 'D'
+)
+
+// 單一檔案在工作區、暫存區與目前版本之間的狀態
+type fileStatus struct {
+	path      string
+	staged    byte // 暫存區相對於目前版本的變更
+	unstaged  byte // 工作區相對於暫存區的變更
+	untracked bool // 工作區有此檔案，但暫存區沒有
+}
+
+// 比較工作區、暫存區與目前版本，回傳有變更的檔案
+func (v *VCS) collectStatus() ([]fileStatus, error) {
+	headManifest, err1 := v.currentManifest()
+	if err1 != nil {
+		return nil, err1
+	}
+
+	stagedManifest, err2 := v.stagedManifest()
+	if err2 != nil {
+		return nil, err2
+	}
+
+	workingManifest, err3 := v.workingManifest(headManifest, stagedManifest)
+	if err3 != nil {
+		return nil, err3
+	}
+
+	// 合併三個狀態中出現的所有路徑
+	paths := map[string]bool{}
+	for _, m := range []manifest{headManifest, stagedManifest, workingManifest} {
+		for path := range m {
+			paths[path] = true
+		}
+	}
+
+	statuses := []fileStatus{}
+	for path := range paths {
+		headHash, inHead := headManifest[path]
+		stagedHash, inStaged := stagedManifest[path]
+		workingHash, inWorking := workingManifest[path]
+
+		status := fileStatus{path: path, staged: statusUnmodified, unstaged: statusUnmodified}
+		switch {
+		case inHead && !inStaged:
+			status.staged = statusDeleted
+		case !inHead && inStaged:
+			status.staged = statusAdded
+		case inHead && inStaged && headHash != stagedHash:
+			status.staged = statusModified
+		}
+		switch {
+		case inStaged && !inWorking:
+			status.unstaged = statusDeleted
+		case inStaged && inWorking && stagedHash != workingHash:
+			status.unstaged = statusModified
+		case !inStaged && inWorking:
+			status.untracked = true
+		}
+
+		if status.staged != statusUnmodified || status.unstaged != statusUnmodified || status.untracked {
+			statuses = append(statuses, status)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].path < statuses[j].path })
+	return statuses, nil
+}
+
+// 取得目前版本的清單，尚未提交過時回傳空清單
+func (v *VCS) currentManifest() (manifest, error) {
+	record, err := v.currentRecord()
+	if err != nil {
+		return nil, err
+	}
+	return v.recordManifest(record)
+}
+
+// 計算暫存區中每個檔案的內容雜湊值
+func (v *VCS) stagedManifest() (manifest, error) {
+	paths, err1 := v.stagedPaths()
+	if err1 != nil {
+		return nil, err1
+	}
+
+	m := manifest{}
+	for _, path := range paths {
+		data, err2 := readStagedFile(v.stagedPath(path))
+		if err2 != nil {
+			return nil, err2
+		}
+		m[path] = hashBytes(data)
+	}
+	return m, nil
+}
+
+// 計算工作區中每個檔案的內容雜湊值
+// 已追蹤的檔案即使符合.vcsignore也會列入，才不會被誤判為已刪除
+func (v *VCS) workingManifest(tracked ...manifest) (manifest, error) {
+	m := manifest{}
+	addWorkingFile := func(path string) error {
+		data, err := os.ReadFile(v.workingPath(path))
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		m[path] = hashBytes(data)
+		return nil
+	}
+
+	err1 := v.walkWorkingTree(".", addWorkingFile)
+	if err1 != nil {
+		return nil, err1
+	}
+
+	for _, trackedManifest := range tracked {
+		for path := range trackedManifest {
+			if _, exists := m[path]; exists {
+				continue
+			}
+			if info, err2 := os.Stat(v.workingPath(path)); err2 == nil && info.Mode().IsRegular() {
+				err3 := addWorkingFile(path)
+				if err3 != nil {
+					return nil, err3
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// 狀態查看，比較工作區、暫存區與目前版本
+// short為true時輸出適合腳本解析的簡短格式：兩個狀態字元加上路徑
+func (v *VCS) Status(short bool) error {
+	// 從檔案讀取currentBranch與目前版本，尚未提交過則為版本0
+	err1 := v.loadState()
+	if err1 != nil {
+		return err1
+	}
+
+	statuses, err4 := v.collectStatus()
+	if err4 != nil {
+		return err4
+	}
+
+	// 合併進行中時，尚未解決衝突的檔案另外列出
+	state, err5 := v.readMergeState()
+	if err5 != nil {
+		return err5
+	}
+	unresolved := map[string]bool{}
+	if state != nil {
+		for _, path := range state.Unresolved {
+			unresolved[path] = true
+		}
+	}
+
+	if short {
+		for _, status := range statuses {
+			if unresolved[status.path] {
+				fmt.Printf("UU %s\n", status.path)
+				continue
+			}
+			if status.staged != statusUnmodified || status.unstaged != statusUnmodified {
+				fmt.Printf("%c%c %s\n", status.staged, status.unstaged, status.path)
+			}
+			if status.untracked {
+				fmt.Printf("?? %s\n", status.path)
+			}
+		}
+		return nil
+	}
+
+	if v.detached() {
+		fmt.Printf("HEAD detached at %s\n", v.versionLabel())
+	} else {
+		fmt.Printf("On the %s branch, version %s\n", v.currentBranch, v.versionLabel())
+	}
+	if state != nil {
+		fmt.Printf("Merging %s into %s\n", state.Source, state.Target)
+		if len(state.Unresolved) == 0 {
+			fmt.Println("  (all conflicts fixed: run \"vcs merge --continue\")")
+		} else {
+			fmt.Println("  (fix conflicts and run \"vcs merge --continue\")")
+		}
+		fmt.Println()
+		printStatusSection("Unmerged paths:", "use \"vcs add <file>...\" to mark resolution", state.Unresolved)
+	}
+
+	// 依類別整理
+	toBeCommitted := []string{}
+	notStaged := []string{}
+	deleted := []string{}
+	untracked := []string{}
+	for _, status := range statuses {
+		if unresolved[status.path] {
+			continue
+		}
+		switch status.staged {
+		case statusAdded:
+			toBeCommitted = append(toBeCommitted, "new file:   "+status.path)
+		case statusModified:
+			toBeCommitted = append(toBeCommitted, "modified:   "+status.path)
+		case statusDeleted:
+			toBeCommitted = append(toBeCommitted, "deleted:    "+status.path)
+		}
+		switch status.unstaged {
+		case statusModified:
+			notStaged = append(notStaged, "modified:   "+status.path)
+		case statusDeleted:
+			deleted = append(deleted, "deleted:    "+status.path)
+		}
+		if status.untracked {
+			untracked = append(untracked, status.path)
+		}
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("Nothing to commit, working tree clean")
+		return nil
+	}
+	printStatusSection("Changes to be committed:", "", toBeCommitted)
+	printStatusSection("Changes not staged for commit:", "use \"vcs add <file>...\" to update what will be committed", notStaged)
+	printStatusSection("Deleted files:", "use \"vcs remove <file>...\" to stop tracking or \"vcs checkout\" to restore", deleted)
+	printStatusSection("Untracked files:", "use \"vcs add <file>...\" to include in what will be committed", untracked)
+	return nil
+}
+
+// 輸出一個狀態區塊，沒有內容時略過
+func printStatusSection(title, hint string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Println(title)
+	if hint != "" {
+		fmt.Printf("  (%s)\n", hint)
+	}
+	for _, line := range lines {
+		fmt.Printf("\t%s\n", line)
+	}
+	fmt.Println()
+}
+
+// 目前版本的顯示名稱：在目前branch資料夾中的版本只顯示編號，從其他branch繼承的版本顯示<branch>@<version>
+func (v *VCS) versionLabel() string {
+	record, err := v.currentRecord()
+	if err != nil || record == nil {
+		return "0"
+	}
+	if record.branch == v.currentBranch {
+		return fmt.Sprintf("%d", record.version)
+	}
+	return record.label()
+}
@@ -0,0 +1,192 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 附註tag的內容，以JSON儲存在tag檔案中；輕量tag的檔案只有提交編號
+type tagInfo struct {
+	Object    string       `json:"object"` // tag指向的提交編號
+	Tagger    commitAuthor `json:"tagger"`
+	Timestamp time.Time    `json:"timestamp"`
+	Message   string       `json:"message"`
+}
+
+// 一個tag
+type tagRecord struct {
+	name      string
+	annotated bool
+	info      tagInfo // 輕量tag只有Object
+}
+
+// 取得tag檔案的路徑
+func (v *VCS) tagRefPath(name string) string {
+	return filepath.Join(v.refsDirectory, "tags", name)
+}
+
+// 讀取tag，tag不存在時回傳nil
+func (v *VCS) readTagRecord(name string) (*tagRecord, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, nil
+	}
+	data, err1 := os.ReadFile(v.tagRefPath(name))
+	if os.IsNotExist(err1) {
+		return nil, nil
+	}
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to read tag %s: %v", name, err1)
+	}
+
+	record := &tagRecord{name: name}
+	content := strings.TrimSpace(string(data))
+	if strings.HasPrefix(content, "{") {
+		record.annotated = true
+		err2 := json.Unmarshal(data, &record.info)
+		if err2 != nil {
+			return nil, fmt.Errorf("unable to decode tag %s: %v", name, err2)
+		}
+	} else {
+		record.info.Object = content
+	}
+	return record, nil
+}
+
+// 讀取tag指向的提交編號，tag不存在時exists為false
+func (v *VCS) readTag(name string) (string, bool, error) {
+	record, err := v.readTagRecord(name)
+	if err != nil || record == nil {
+		return "", false, err
+	}
+	return record.info.Object, true, nil
+}
+
+// 列出所有tag名稱
+func (v *VCS) tagNames() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(v.refsDirectory, "tags"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read tags: %v", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// 建立tag，指向revision對應的版本；message不為空時建立附註tag，記錄建立者與時間
+// force為true時覆蓋同名的tag
+func (v *VCS) CreateTag(name, revision, message string, annotated, force bool) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	// 從檔案讀取currentBranch與目前版本
+	err1 := v.loadState()
+	if err1 != nil {
+		return err1
+	}
+
+	err2 := validateRefName("tag", name)
+	if err2 != nil {
+		return err2
+	}
+	if annotated && message == "" {
+		return fmt.Errorf("annotated tag %s needs a message", name)
+	}
+
+	existing, err3 := v.readTagRecord(name)
+	if err3 != nil {
+		return err3
+	}
+	if existing != nil && !force {
+		return fmt.Errorf("tag %s already exists", name)
+	}
+
+	if revision == "" {
+		revision = "HEAD"
+	}
+	record, err4 := v.resolveRevision(revision)
+	if err4 != nil {
+		return err4
+	}
+
+	// 輕量tag只記錄提交編號，附註tag以JSON記錄完整資訊
+	data := []byte(record.id)
+	if annotated {
+		info := tagInfo{Object: record.id, Tagger: currentAuthor(), Timestamp: time.Now(), Message: message}
+		var err5 error
+		if data, err5 = json.MarshalIndent(info, "", "  "); err5 != nil {
+			return fmt.Errorf("unable to encode tag %s: %v", name, err5)
+		}
+	}
+	err6 := writeFileAtomic(v.tagRefPath(name), data)
+	if err6 != nil {
+		return fmt.Errorf("unable to write tag %s: %v", name, err6)
+	}
+
+	fmt.Printf("Tagged version %s (%s) as %s\n", record.label(), shortID(record.id), name)
+	return nil
+}
+
+// 刪除tag，不影響tag指向的版本
+func (v *VCS) DeleteTag(name string) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	existing, err1 := v.readTagRecord(name)
+	if err1 != nil {
+		return err1
+	}
+	if existing == nil {
+		return fmt.Errorf("tag %s does not exist", name)
+	}
+
+	err2 := os.Remove(v.tagRefPath(name))
+	if err2 != nil {
+		return fmt.Errorf("unable to delete tag %s: %v", name, err2)
+	}
+	fmt.Printf("Deleted tag %s (was %s)\n", name, shortID(existing.info.Object))
+	return nil
+}
+
+// 列出所有tag與其指向的版本，附註tag另外顯示建立者、時間與訊息
+func (v *VCS) ListTags() error {
+	names, err1 := v.tagNames()
+	if err1 != nil {
+		return err1
+	}
+
+	for _, name := range names {
+		tag, err2 := v.readTagRecord(name)
+		if err2 != nil {
+			return err2
+		}
+		label := "missing version"
+		if record, err3 := v.findCommit(tag.info.Object); err3 == nil {
+			label = record.label()
+		}
+
+		fmt.Printf("%-20s %s %s\n", name, shortID(tag.info.Object), label)
+		if tag.annotated {
+			fmt.Printf("    Tagger: %s\n", formatAuthor(tag.info.Tagger))
+			fmt.Printf("    Date:   %s\n", tag.info.Timestamp.Format(time.RFC1123Z))
+			fmt.Printf("\n        %s\n\n", tag.info.Message)
+		}
+	}
+	return nil
+}
@@ -4,33 +4,92 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 )
 
 // VCS資料結構
 type VCS struct {
+	workingDirectory string
 	repoDirectory    string
 	filesDirectory   string
 	historyDirectory string
+	objectsDirectory string
+	refsDirectory    string
 	currentBranch    string
 	currentVersion   int
+	currentCommit    string                   // 目前簽出版本的提交編號
+	commits          map[string]*commitRecord // 已讀取的版本，寫入新版本後清除
+	lockDepth        int                      // 巢狀取得儲存庫鎖的次數，回到0時釋放鎖
+	packs            map[string]packedObject  // 已讀取的打包檔索引，寫入新的打包檔後清除
 }
 
-// 創建VCS
+// 儲存庫資料夾的名稱，位於工作目錄的最上層
+const repoFolderName = ".vcs"
+
+// 指定工作目錄的環境變數，優先於向上尋找.vcs資料夾
+const repoEnvironmentVariable = "VCS_DIR"
+
+// 創建VCS：環境變數VCS_DIR有設定時以它為工作目錄，否則從目前資料夾往上層尋找含有.vcs的資料夾，
+// 都找不到時以目前資料夾為工作目錄（例如執行init之前）
 func NewVCS() *VCS {
-	repoDirectory := ".vcs" // 隱藏的資料夾，用來儲存各版本檔案
+	if root := os.Getenv(repoEnvironmentVariable); root != "" {
+		return NewVCSAt(root)
+	}
+	return NewVCSAt(findWorkingDirectory())
+}
+
+// 以root為工作目錄創建VCS，儲存庫位於root/.vcs；root本身是.vcs資料夾時以它的父資料夾為工作目錄
+func NewVCSAt(root string) *VCS {
+	workingDirectory := filepath.Clean(root) // 開發程式所在的工作目錄
+	if filepath.Base(workingDirectory) == repoFolderName {
+		workingDirectory = filepath.Dir(workingDirectory)
+	}
+	repoDirectory := filepath.Join(workingDirectory, repoFolderName) // 隱藏的資料夾，用來儲存各版本檔案
 	filesDirectory := filepath.Join(repoDirectory, "files")
 	historyDirectory := filepath.Join(repoDirectory, "history")
+	objectsDirectory := filepath.Join(repoDirectory, "objects")
+	refsDirectory := filepath.Join(repoDirectory, "refs")
 	currentBranch := "main"
 	currentVersion := 0
-	return &VCS{repoDirectory: repoDirectory, filesDirectory: filesDirectory, historyDirectory: historyDirectory, currentBranch: currentBranch, currentVersion: currentVersion}
+	return &VCS{workingDirectory: workingDirectory, repoDirectory: repoDirectory, filesDirectory: filesDirectory, historyDirectory: historyDirectory, objectsDirectory: objectsDirectory, refsDirectory: refsDirectory, currentBranch: currentBranch, currentVersion: currentVersion}
+}
+
+// 從目前資料夾往上層尋找含有.vcs資料夾的工作目錄，回傳相對於目前資料夾的路徑（例如.或../..），
+// 讓在工作目錄最上層執行時的輸出與路徑維持不變；找不到時回傳目前資料夾
+func findWorkingDirectory() string {
+	current, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	for directory := current; ; directory = filepath.Dir(directory) {
+		if info, err := os.Stat(filepath.Join(directory, repoFolderName)); err == nil && info.IsDir() {
+			relativePath, err := filepath.Rel(current, directory)
+			if err != nil {
+				return directory
+			}
+			return relativePath
+		}
+		if filepath.Dir(directory) == directory {
+			return "."
+		}
+	}
 }
 
 // 初始化VCS，創建必要的文件夹
 func (v *VCS) Init() error {
-	// 檢查repoDirectory是否存在
-	if _, err1 := os.Stat(v.repoDirectory); os.IsNotExist(err1) {
+	// 檢查repoDirectory是否存在，以建立資料夾判斷，同時執行的另一個init會在這裡失敗
+	err8 := os.MkdirAll(filepath.Dir(v.repoDirectory), os.ModePerm)
+	if err8 != nil {
+		return fmt.Errorf("unable to create repository folder: %v", err8)
+	}
+	if err1 := os.Mkdir(v.repoDirectory, os.ModePerm); err1 == nil {
+		// 其他指令在建立完成前會等待鎖釋放，不會讀到只建立一半的儲存庫
+		if err := v.lock(); err != nil {
+			return err
+		}
+		defer v.unlock()
+
 		// 創建filesDirectory
 		err2 := os.MkdirAll(v.filesDirectory, os.ModePerm)
 		if err2 != nil {
@@ -43,6 +102,12 @@ func (v *VCS) Init() error {
 			return fmt.Errorf("unable to create history folder: %v", err3)
 		}
 
+		// 創建objectsDirectory，存放以雜湊值命名的檔案內容
+		err6 := os.MkdirAll(v.objectsDirectory, os.ModePerm)
+		if err6 != nil {
+			return fmt.Errorf("unable to create objects folder: %v", err6)
+		}
+
 		// 創建main branch資料夹
 		mainBranchDirectory := filepath.Join(v.historyDirectory, "main")
 		err4 := os.MkdirAll(mainBranchDirectory, os.ModePerm)
@@ -50,6 +115,12 @@ func (v *VCS) Init() error {
 			return fmt.Errorf("unable to create main branch folder: %v", err4)
 		}
 
+		// 創建main branch指標，尚未提交前為空
+		err7 := v.writeBranchHead("main", "")
+		if err7 != nil {
+			return err7
+		}
+
 		// 將currentBranch寫入檔案
 		err5 := v.writeCurrentBranch()
 		if err5 != nil {
@@ -58,13 +129,20 @@ func (v *VCS) Init() error {
 
 		fmt.Printf("Initialized empty VCS repository in %s\n", v.repoDirectory)
 		return nil
-	} else {
+	} else if os.IsExist(err1) {
 		return fmt.Errorf("repository already exists at %s", v.repoDirectory)
+	} else {
+		return fmt.Errorf("unable to create repository folder: %v", err1)
 	}
 }
 
-// 將文件添加到版本控制
+// 將文件添加到版本控制，指定資料夾時會遞迴加入其中未被.vcsignore忽略的檔案
 func (v *VCS) Add(filename string) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
 	// 檢查files資料夾是否存在
 	if _, err1 := os.Stat(v.filesDirectory); os.IsNotExist(err1) {
 		err2 := os.MkdirAll(v.filesDirectory, os.ModePerm)
@@ -74,24 +152,71 @@ func (v *VCS) Add(filename string) error {
 	}
 
 	// 檢查檔案是否存在
-	if _, err3 := os.Stat(filename); os.IsNotExist(err3) {
+	info, err3 := os.Stat(filename)
+	if os.IsNotExist(err3) {
 		return fmt.Errorf("file does not exist: %s", filename)
 	}
+	if err3 != nil {
+		return fmt.Errorf("cannot access path %s: %v", filename, err3)
+	}
 
-	// 複製檔案到file資料夾
-	destinationPath := filepath.Join(v.filesDirectory, filepath.Base(filename))
-	err4 := copyFile(filename, destinationPath)
+	// 取得相對於工作目錄的路徑，保留資料夾結構
+	path, err4 := v.relativePath(filename)
 	if err4 != nil {
-		return fmt.Errorf("failed to add file: %v", err4)
+		return err4
 	}
 
-	fmt.Printf("Added %s to version control.\n", filename)
+	// 單一檔案直接加入，合併進行中時代表已解決該檔案的衝突
+	if !info.IsDir() {
+		err6 := v.addFile(path)
+		if err6 != nil {
+			return err6
+		}
+		return v.markResolved(path)
+	}
+
+	// 資料夾則遞迴加入
+	count := 0
+	err5 := v.walkWorkingTree(path, func(filePath string) error {
+		count++
+		return v.addFile(filePath)
+	})
+	if err5 != nil {
+		return err5
+	}
+	if count == 0 {
+		fmt.Printf("No files to add in %s.\n", filename)
+	}
+	return v.markResolved(path)
+}
+
+// 將工作區中的單一檔案複製到暫存區
+func (v *VCS) addFile(path string) error {
+	data, err1 := os.ReadFile(v.workingPath(path))
+	if err1 != nil {
+		return fmt.Errorf("failed to add file: %v", err1)
+	}
+	err2 := writeStagedFile(v.stagedPath(path), data)
+	if err2 != nil {
+		return fmt.Errorf("failed to add file: %v", err2)
+	}
+
+	fmt.Printf("Added %s to version control.\n", path)
 	return nil
 }
 
 // 將files中的指定資料夾或檔案移除
 func (v *VCS) Remove(filename string) error {
-	removePath := filepath.Join(v.filesDirectory, filepath.Base(filename))
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	path, err4 := v.relativePath(filename)
+	if err4 != nil {
+		return err4
+	}
+	removePath := v.stagedPath(path)
 
 	// 檢查路徑是否存在
 	info, err1 := os.Stat(removePath)
@@ -115,211 +240,359 @@ func (v *VCS) Remove(filename string) error {
 		}
 		fmt.Printf("File %s has been successfully deleted.\n", removePath)
 	}
-	return nil
+
+	// 移除留下的空資料夾
+	removeEmptyParents(filepath.Dir(removePath), v.filesDirectory)
+
+	// 合併進行中時，移除檔案也代表解決了該檔案的衝突
+	return v.markResolved(path)
 }
 
 // 提交目前狀態，並產生新版本
 func (v *VCS) Commit(message string) error {
-	// 從檔案讀取currentBranch
-	err1 := v.readCurrentBranch()
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	// 從檔案讀取currentBranch與目前版本
+	err1 := v.loadState()
 	if err1 != nil {
 		return err1
 	}
 
-	// 將版本編號加1
-	v.currentVersion = v.getCurrentVersionOfBranch(v.currentBranch) + 1
-
-	// 生成一個新版本的路徑
-	versionDirectory := filepath.Join(v.historyDirectory, v.currentBranch, fmt.Sprintf("version_%d", v.currentVersion))
-
-	// 創建新版本資料夾
-	err2 := os.Mkdir(versionDirectory, os.ModePerm)
+	// 合併進行中時需以merge --continue完成合併
+	err2 := v.checkNoMergeInProgress()
 	if err2 != nil {
-		return fmt.Errorf("unable to create version folder: %v", err2)
+		return err2
 	}
 
-	// 複製檔案到版本資料夾
-	files, err3 := os.ReadDir(v.filesDirectory)
+	// 新版本接在目前版本之後，目前版本為父版本；不在分離HEAD時目前版本就是branch最新的版本
+	head, err3 := v.currentRecord()
 	if err3 != nil {
-		return fmt.Errorf("unable to read folder: %v", err3)
+		return err3
 	}
-
-	for _, file := range files {
-		filePath := filepath.Join(v.filesDirectory, file.Name())
-		if info, err4 := os.Stat(filePath); err4 == nil && !info.IsDir() {
-			err5 := copyFile(filePath, filepath.Join(versionDirectory, file.Name()))
-			if err5 != nil {
-				return fmt.Errorf("file copy failure: %v", err5)
-			}
-		}
+	parents := []string{}
+	if head != nil {
+		parents = append(parents, head.id)
 	}
 
-	// 更新目前version為新version
-	err6 := v.writeCurrentVersion()
-	if err6 != nil {
-		return err6
+	// 將暫存區檔案存入物件庫
+	versionManifest, err4 := v.stagedObjects(head)
+	if err4 != nil {
+		return err4
 	}
 
-	// 寫入提交訊息
-	messagePath := filepath.Join(versionDirectory, "commit_message.txt")
-	err7 := os.WriteFile(messagePath, []byte(message), 0644)
-	if err7 != nil {
-		return fmt.Errorf("failed to write commit message: %v", err7)
+	id, err5 := v.createVersion(v.currentBranch, head, versionManifest, message, parents)
+	if err5 != nil {
+		return err5
 	}
 
-	fmt.Printf("Committed version %d with message: %s\n", v.currentVersion, message)
+	fmt.Printf("Committed version %d (%s) with message: %s\n", v.currentVersion, shortID(id), message)
+	if v.detached() {
+		fmt.Println("Warning: this version was committed on a detached HEAD and is not on any branch.")
+		fmt.Println("  To keep it, run \"vcs create-branch <branch name>\".")
+	}
 	return nil
 }
 
-// 取得branch所有提交記錄
-func (v *VCS) Log() error {
-	// 從檔案讀取currentBranch
-	err1 := v.readCurrentBranch()
-	if err1 != nil {
-		return err1
+// 將暫存區檔案存入物件庫，回傳版本清單；head的檔案作為差異儲存的基底
+func (v *VCS) stagedObjects(head *commitRecord) (manifest, error) {
+	previousManifest := manifest{}
+	if head != nil {
+		if m, err1 := readManifest(head.directory); err1 == nil {
+			previousManifest = m
+		}
 	}
 
-	fmt.Printf("On the %s branch\n", v.currentBranch)
-
-	// 只查看目前branch的所有版本
-	branchDirectory := filepath.Join(v.historyDirectory, v.currentBranch)
-	files, err2 := os.ReadDir(branchDirectory)
+	paths, err2 := v.stagedPaths()
 	if err2 != nil {
-		return fmt.Errorf("unable to read folder: %v", err2)
+		return nil, err2
 	}
 
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "version_") {
-			version := strings.TrimPrefix(file.Name(), "version_")
-			messagePath := filepath.Join(branchDirectory, file.Name(), "commit_message.txt")
-			message, err3 := os.ReadFile(messagePath)
-			if err3 != nil {
-				return fmt.Errorf("unable to read commit message for version %s: %v", version, err3)
-			}
-			fmt.Printf("Version %s: %s\n", version, message)
+	versionManifest := manifest{}
+	for _, path := range paths {
+		data, err3 := readStagedFile(v.stagedPath(path))
+		if err3 != nil {
+			return nil, err3
+		}
+		hash, err4 := v.writeObject(path, data, previousManifest[path])
+		if err4 != nil {
+			return nil, err4
 		}
+		versionManifest[path] = hash
 	}
-	return nil
+	return versionManifest, nil
 }
 
-// 狀態查看，搜尋結果目前資料夾內容
-func (v *VCS) Status() error {
-	// 從檔案讀取currentBranch
-	err1 := v.readCurrentBranch()
+// 在branch中建立新版本並將branch指向它，成為目前版本，回傳提交編號
+// branch為detachedHead時，版本放在分離HEAD專用的資料夾，不移動任何branch
+func (v *VCS) createVersion(branch string, head *commitRecord, m manifest, message string, parents []string) (string, error) {
+	folder := branch
+	if branch == detachedHead {
+		folder = detachedFolder
+	}
+
+	// 生成一個新版本的路徑，版本編號接在branch最新的版本之後
+	version := v.nextVersionNumber(folder, head)
+	versionDirectory := filepath.Join(v.historyDirectory, folder, fmt.Sprintf("version_%d", version))
+
+	// 先在暫存的資料夾中寫入版本，完成後才改名為版本資料夾，中斷時不會留下不完整的版本
+	err1 := os.MkdirAll(filepath.Dir(versionDirectory), os.ModePerm)
 	if err1 != nil {
-		return err1
+		return "", fmt.Errorf("unable to create version folder: %v", err1)
+	}
+	if _, err6 := os.Stat(versionDirectory); err6 == nil {
+		return "", fmt.Errorf("version folder %s already exists", versionDirectory)
+	}
+	temporaryDirectory, err7 := os.MkdirTemp(filepath.Dir(versionDirectory), fmt.Sprintf("%sversion_%d-", temporaryPrefix, version))
+	if err7 != nil {
+		return "", fmt.Errorf("unable to create version folder: %v", err7)
 	}
 
-	// 從檔案讀取currentVersion
-	err2 := v.readCurrentVersion()
+	// 寫入版本清單與提交資訊，版本資料夾只記錄版本清單
+	id, err2 := v.writeVersion(temporaryDirectory, branch, version, m, message, parents)
 	if err2 != nil {
-		return err2
+		os.RemoveAll(temporaryDirectory)
+		return "", err2
 	}
 
-	fmt.Printf("On the %s branch, version %d\n", v.currentBranch, v.currentVersion)
+	// 改名前先記錄這次提交，中斷時啟動的檢查依此記錄完成提交
+	pending := pendingCommit{Branch: branch, Version: version, Commit: id, Current: v.currentCommit}
+	if head != nil {
+		pending.Head = head.id
+	}
+	err8 := v.writePendingCommit(pending)
+	if err8 != nil {
+		os.RemoveAll(temporaryDirectory)
+		return "", err8
+	}
+	err9 := os.Rename(temporaryDirectory, versionDirectory)
+	if err9 != nil {
+		os.RemoveAll(temporaryDirectory)
+		v.removePendingCommit()
+		return "", fmt.Errorf("unable to publish version %d: %v", version, err9)
+	}
 
-	files, err := os.ReadDir(v.filesDirectory)
-	if err != nil {
-		return fmt.Errorf("unable to read folder: %v", err)
+	// 將branch指向新版本
+	if branch != detachedHead {
+		err3 := v.writeBranchHead(branch, id)
+		if err3 != nil {
+			return "", err3
+		}
 	}
 
-	if len(files) == 0 {
-		return fmt.Errorf("no files are being tracked")
+	// 更新目前version為新version
+	v.currentBranch = branch
+	v.currentVersion = version
+	v.currentCommit = id
+	err4 := v.writeCurrentBranch()
+	if err4 != nil {
+		return "", err4
+	}
+	err5 := v.writeCurrentCommit()
+	if err5 != nil {
+		return "", err5
 	}
+	err10 := v.removePendingCommit()
+	if err10 != nil {
+		return "", err10
+	}
+	return id, nil
+}
 
-	// 若有檔案，列出追蹤的檔案
-	fmt.Println("Tracked files:")
-	for _, file := range files {
-		fmt.Println(file.Name())
+// 取得branch所有提交記錄，包含從其他branch合併或分出的祖先版本
+func (v *VCS) Log() error {
+	// 從檔案讀取currentBranch
+	err1 := v.loadState()
+	if err1 != nil {
+		return err1
+	}
+
+	// 分離HEAD時列出目前版本的歷史
+	head := v.currentCommit
+	if v.detached() {
+		fmt.Printf("HEAD detached at %s\n", v.versionLabel())
+	} else {
+		fmt.Printf("On the %s branch\n", v.currentBranch)
+		var err2 error
+		if head, err2 = v.readBranchHead(v.currentBranch); err2 != nil {
+			return err2
+		}
+	}
+	records, err3 := v.history(head)
+	if err3 != nil {
+		return err3
+	}
+
+	for _, record := range records {
+		info := record.info
+		parents := []string{}
+		for _, parent := range info.Parents {
+			parents = append(parents, shortID(parent))
+		}
+
+		fmt.Printf("Version %s (commit %s)\n", record.label(), shortID(record.id))
+		fmt.Printf("Author:   %s\n", formatAuthor(info.Author))
+		fmt.Printf("Date:     %s\n", info.Timestamp.Format(time.RFC1123Z))
+		fmt.Printf("Branch:   %s\n", info.Branch)
+		if len(parents) > 0 {
+			fmt.Printf("Parents:  %s\n", strings.Join(parents, " "))
+		}
+		fmt.Printf("Manifest: %s\n", shortID(info.Manifest))
+		fmt.Printf("\n    %s\n\n", info.Message)
 	}
 	return nil
 }
 
-// 切換到指定版本
-func (v *VCS) Checkout(version int) error {
+// 切換到指定版本，revision可以是版本編號、<branch>@<version>、tag或提交編號等版本表示式
+// 有會被覆蓋的本地修改時停止，options可指定捨棄或合併這些修改
+func (v *VCS) Checkout(revision string, options CheckoutOptions) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
 	// 從檔案讀取currentBranch
-	err1 := v.readCurrentBranch()
+	err1 := v.loadState()
 	if err1 != nil {
-		return nil
+		return err1
 	}
 
-	versionDirectory := filepath.Join(v.historyDirectory, v.currentBranch, fmt.Sprintf("version_%d", version))
-	files, err2 := os.ReadDir(versionDirectory)
-	if err2 != nil {
-		return fmt.Errorf("version %d does not exist: %v", version, err2)
+	err4 := v.checkNoMergeInProgress()
+	if err4 != nil {
+		return err4
 	}
 
-	// 取得.vcs的父資料夾，開發程式所在的工作目錄
-	workingDirectory := filepath.Dir(v.repoDirectory)
-
-	// 複製檔案
-	for _, file := range files {
-		if file.Name() != "commit_message.txt" {
-			sourcePath := filepath.Join(versionDirectory, file.Name())
+	// 指定branch名稱時切換到該branch
+	if v.branchExists(revision) {
+		if _, isTag, _ := v.readTag(revision); !isTag {
+			return v.CheckoutBranch(revision, options)
+		}
+	}
 
-			// 清空暫存區資料夾
-			err3 := clearFolder(v.filesDirectory)
-			if err3 != nil {
-				return err3
-			}
+	record, err2 := v.resolveRevision(revision)
+	if err2 != nil {
+		return err2
+	}
 
-			// 複製到工作區
-			destinationPathRepo := filepath.Join(workingDirectory, file.Name())
-			err4 := copyFile(sourcePath, destinationPathRepo)
-			if err4 != nil {
-				return fmt.Errorf("unable to switch workspace version for %s: %v", file.Name(), err4)
-			}
+	// 先檢查本地修改，停止時不改變任何狀態
+	plan, err8 := v.planCheckout(record, options)
+	if err8 != nil {
+		return err8
+	}
 
-			// 複製到暫存區
-			destinationPath := filepath.Join(v.filesDirectory, file.Name())
-			err5 := copyFile(sourcePath, destinationPath)
-			if err5 != nil {
-				return fmt.Errorf("unable to switch the staging area version for %s: %v", file.Name(), err5)
-			}
+	// 不是目前branch最新的版本時進入分離HEAD狀態，之後的提交不會移動任何branch
+	previousCommit := v.currentCommit
+	wasDetached := v.detached()
+	headID := ""
+	if !wasDetached {
+		var err5 error
+		if headID, err5 = v.readBranchHead(v.currentBranch); err5 != nil {
+			return err5
+		}
+	}
+	if record.id != headID {
+		v.currentBranch = detachedHead
+		err6 := v.writeCurrentBranch()
+		if err6 != nil {
+			return err6
 		}
 	}
 
-	// 更新目前version為新version
-	v.currentVersion = version
-	err5 := v.writeCurrentVersion()
-	if err5 != nil {
-		return err5
+	// 從物件庫還原檔案
+	err3 := v.completeCheckout(plan, record)
+	if err3 != nil {
+		return err3
 	}
 
-	fmt.Printf("Checked out version %d\n", version)
+	if wasDetached && previousCommit != record.id {
+		err7 := v.warnIfUnreachable(previousCommit)
+		if err7 != nil {
+			return err7
+		}
+	}
+	fmt.Printf("Checked out version %s (%s)\n", v.versionLabel(), shortID(record.id))
+	if v.detached() && !wasDetached {
+		fmt.Printf("You are in a detached HEAD state: %s is not the latest version of a branch.\n", record.label())
+		fmt.Println("  Versions committed here are not on any branch; use \"vcs create-branch <branch name>\" to keep them,")
+		fmt.Println("  or \"vcs checkout-branch <branch name>\" to go back to a branch.")
+	}
 	return nil
 }
 
-// 創建分支
-func (v *VCS) CreateBranch(branchName string) error {
+// 創建分支，新branch指向revision對應的版本，revision為空字串時為目前簽出的版本
+// switchTo為true時切換到新branch並還原該版本的檔案，否則不改變目前branch與工作區
+func (v *VCS) CreateBranch(branchName, revision string, switchTo bool) error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
 	// 從檔案讀取currentBranch
-	err1 := v.readCurrentBranch()
+	err1 := v.loadState()
 	if err1 != nil {
 		return err1
 	}
 
-	branchDirectory := filepath.Join(v.historyDirectory, branchName)
-	if _, err2 := os.Stat(branchDirectory); !os.IsNotExist(err2) {
+	err8 := v.checkNoMergeInProgress()
+	if err8 != nil {
+		return err8
+	}
+
+	err2 := validateRefName("branch", branchName)
+	if err2 != nil {
+		return err2
+	}
+	if v.branchExists(branchName) {
 		return fmt.Errorf("branch %s already exists", branchName)
 	}
 
-	// 創建branch資料夾
-	err3 := os.Mkdir(branchDirectory, os.ModePerm)
-	if err3 != nil {
-		return fmt.Errorf("unable to create branch directory: %v", err3)
+	// 取得新branch的起點，尚未有任何提交時新branch也沒有版本
+	var head *commitRecord
+	if revision != "" || v.currentCommit != "" {
+		if revision == "" {
+			revision = "HEAD"
+		}
+		var err3 error
+		if head, err3 = v.resolveRevision(revision); err3 != nil {
+			return err3
+		}
 	}
 
-	// 將目前版本的檔案複製到新branch
-	v.currentVersion = v.getCurrentVersionOfBranch(v.currentBranch)
-	sourceVersionDirectory := filepath.Join(v.historyDirectory, v.currentBranch, fmt.Sprintf("version_%d", v.currentVersion))
-	destinationVersionDirectory := filepath.Join(branchDirectory, fmt.Sprintf("version_%d", v.currentVersion))
-	err4 := os.Mkdir(destinationVersionDirectory, os.ModePerm)
+	// 切換到新branch時先檢查本地修改，停止時不建立branch
+	var plan *switchPlan
+	if switchTo {
+		var err9 error
+		if plan, err9 = v.planCheckout(head, CheckoutOptions{}); err9 != nil {
+			return err9
+		}
+	}
+
+	// 創建branch資料夾，之後在新branch提交的版本會放在這裡
+	branchDirectory := filepath.Join(v.historyDirectory, branchName)
+	err4 := os.MkdirAll(branchDirectory, os.ModePerm)
 	if err4 != nil {
-		return fmt.Errorf("unable to create version folder: %v", err4)
+		return fmt.Errorf("unable to create branch directory: %v", err4)
 	}
-	err5 := v.createVersionSnapshot(sourceVersionDirectory, destinationVersionDirectory)
+
+	// 新branch與起點所在的branch共用既有的版本，只需記錄指向的提交編號
+	headID := ""
+	if head != nil {
+		headID = head.id
+	}
+	err5 := v.writeBranchHead(branchName, headID)
 	if err5 != nil {
-		return fmt.Errorf("unable to create snapshot for branch: %v", err5)
+		return err5
+	}
+
+	if !switchTo {
+		if head != nil {
+			fmt.Printf("Branch %s created at version %s (%s)\n", branchName, head.label(), shortID(head.id))
+		} else {
+			fmt.Printf("Branch %s created\n", branchName)
+		}
+		return nil
 	}
 
 	// 更新目前branch為新branch
@@ -330,7 +603,7 @@ func (v *VCS) CreateBranch(branchName string) error {
 	}
 
 	// 更新目前version為新version
-	err7 := v.writeCurrentVersion()
+	err7 := v.completeCheckout(plan, head)
 	if err7 != nil {
 		return err7
 	}
@@ -339,160 +612,60 @@ func (v *VCS) CreateBranch(branchName string) error {
 	return nil
 }
 
-// 切換branch
-func (v *VCS) CheckoutBranch(branchName string) error {
-	branchDirectory := filepath.Join(v.historyDirectory, branchName)
-	if _, err1 := os.Stat(branchDirectory); os.IsNotExist(err1) {
-		return fmt.Errorf("branch %s does not exist", branchName)
+// 切換branch，有會被覆蓋的本地修改時停止，options可指定捨棄或合併這些修改
+func (v *VCS) CheckoutBranch(branchName string, options CheckoutOptions) error {
+	if err := v.lock(); err != nil {
+		return err
 	}
+	defer v.unlock()
 
-	// 更新目前分支為指定branch
-	v.currentBranch = branchName
-	err2 := v.writeCurrentBranch()
-	if err2 != nil {
-		return err2
-	}
-
-	v.currentVersion = v.getCurrentVersionOfBranch(v.currentBranch)
-	v.Checkout(v.currentVersion)
-
-	// 更新目前version為新version
-	err3 := v.writeCurrentVersion()
-	if err3 != nil {
-		return err3
-	}
-
-	fmt.Printf("Checked out to branch: %s\n", branchName)
-	return nil
-}
-
-// 合併來源branch到目標branch
-func (v *VCS) Merge(targetBranch, sourceBranch string) error {
-	// 目標branch或來源branch不存在，則傳回錯誤
-	targetBranchDirectory := filepath.Join(v.historyDirectory, targetBranch)
-	sourceBranchDirectory := filepath.Join(v.historyDirectory, sourceBranch)
-
-	if _, err1 := os.Stat(targetBranchDirectory); err1 != nil {
-		if os.IsNotExist(err1) {
-			return fmt.Errorf("target branch %s does not exist", targetBranch)
-		}
-		return fmt.Errorf("error checking target branch %s: %v", targetBranch, err1)
+	err5 := v.loadState()
+	if err5 != nil {
+		return err5
 	}
 
-	if _, err2 := os.Stat(sourceBranchDirectory); err2 != nil {
-		if os.IsNotExist(err2) {
-			return fmt.Errorf("source branch %s does not exist", sourceBranch)
-		}
-		return fmt.Errorf("error checking source branch %s: %v", sourceBranch, err2)
+	err4 := v.checkNoMergeInProgress()
+	if err4 != nil {
+		return err4
 	}
 
-	// 取得目標branch與來源branch的最大版本路徑
-	targetVersion := v.getCurrentVersionOfBranch(targetBranch)
-	sourceVersion := v.getCurrentVersionOfBranch(sourceBranch)
-
-	targetVersionDirectory := filepath.Join(targetBranchDirectory, fmt.Sprintf("version_%d", targetVersion))
-	targetFiles, err3 := os.ReadDir(targetVersionDirectory)
-	if err3 != nil {
-		return fmt.Errorf("failed to read target branch version file: %s", err3)
+	if !v.branchExists(branchName) {
+		return fmt.Errorf("branch %s does not exist", branchName)
 	}
 
-	sourceVersionDirectory := filepath.Join(sourceBranchDirectory, fmt.Sprintf("version_%d", sourceVersion))
-	sourceFiles, err4 := os.ReadDir(sourceVersionDirectory)
-	if err4 != nil {
-		return fmt.Errorf("failed to read source branch version file: %s", err3)
+	head, err1 := v.branchHead(branchName)
+	if err1 != nil {
+		return err1
 	}
 
-	// 將來源branch檔案合併到目標branch
-	mergeVersionDirectory := filepath.Join(targetBranchDirectory, fmt.Sprintf("version_%d", targetVersion+1))
-	err5 := os.Mkdir(mergeVersionDirectory, os.ModePerm)
-	if err5 != nil {
-		return fmt.Errorf("unable to create merged revision folder: %s", err4)
-	}
-
-	// 複製文件
-	for _, targetFile := range targetFiles {
-		if targetFile.Name() != "commit_message.txt" {
-			targetFilePath := filepath.Join(targetVersionDirectory, targetFile.Name())
-
-			// 問使用者是否要複製檔案
-			fmt.Printf("Target File: %s\n", targetFilePath)
-			var userChoice string
-			fmt.Print("Do you want to copy this file to the merge directory? (yes/no): ")
-			fmt.Scanln(&userChoice)
-
-			// 檢查使用者輸入
-			if strings.ToLower(userChoice) == "yes" {
-				destinationPath := filepath.Join(mergeVersionDirectory, targetFile.Name())
-				err5 := copyFile(targetFilePath, destinationPath)
-				if err5 != nil {
-					return fmt.Errorf("failed to copy file: %s", err5)
-				}
-			}
-		}
+	// 先檢查本地修改，停止時不改變任何狀態
+	plan, err7 := v.planCheckout(head, options)
+	if err7 != nil {
+		return err7
 	}
 
-	for _, sourceFile := range sourceFiles {
-		if sourceFile.Name() != "commit_message.txt" {
-			sourceFilePath := filepath.Join(targetVersionDirectory, sourceFile.Name())
-
-			// 問使用者是否要複製檔案
-			fmt.Printf("Source File: %s\n", sourceFilePath)
-			var userChoice1 string
-			fmt.Print("Do you want to copy this file to the merge directory? (yes/no): ")
-			fmt.Scanln(&userChoice1)
-
-			// 檢查使用者輸入
-			if strings.ToLower(userChoice1) == "yes" {
-				_, err6 := os.Stat(sourceFilePath)
-				if os.IsNotExist(err6) {
-					destinationPath := filepath.Join(mergeVersionDirectory, sourceFile.Name())
-					err7 := copyFile(sourceFilePath, destinationPath)
-					if err7 != nil {
-						return fmt.Errorf("failed to copy file: %s", err7)
-					}
-				} else {
-					var userChoice2 string
-					fmt.Print("Do you want to overwrite the target file?? (yes/no): ")
-					fmt.Scanln(&userChoice2)
-					if strings.ToLower(userChoice2) == "yes" {
-						_, err8 := os.Stat(sourceFilePath)
-						if os.IsNotExist(err8) {
-							destinationPath := filepath.Join(mergeVersionDirectory, sourceFile.Name())
-							err9 := copyFile(sourceFilePath, destinationPath)
-							if err9 != nil {
-								return fmt.Errorf("failed to copy file: %s", err9)
-							}
-						}
-					}
-				}
-			}
+	// 離開分離HEAD時，提醒沒有在任何branch上的版本
+	if v.detached() {
+		err6 := v.warnIfUnreachable(v.currentCommit)
+		if err6 != nil {
+			return err6
 		}
 	}
 
-	// 合併完成，提交訊息
-	commitMessage := fmt.Sprintf("Merged %s into %s", sourceBranch, targetBranch)
-	messagePath := filepath.Join(mergeVersionDirectory, "commit_message.txt")
-	err6 := os.WriteFile(messagePath, []byte(commitMessage), 0644)
-	if err6 != nil {
-		return fmt.Errorf("failed to write commit message: %s", err6)
-	}
-
 	// 更新目前分支為指定branch
-	v.currentBranch = targetBranch
-	err7 := v.writeCurrentBranch()
-	if err7 != nil {
-		return err7
+	v.currentBranch = branchName
+	err2 := v.writeCurrentBranch()
+	if err2 != nil {
+		return err2
 	}
 
 	// 更新目前version為新version
-	v.currentVersion = targetVersion + 1
-	err8 := v.writeCurrentVersion()
-	if err8 != nil {
-		return err8
+	err3 := v.completeCheckout(plan, head)
+	if err3 != nil {
+		return err3
 	}
 
-	// 提交合併後的版本
-	fmt.Printf("Successfully merged %s into %s\n", sourceBranch, targetBranch)
+	fmt.Printf("Checked out to branch: %s\n", branchName)
 	return nil
 }
 
@@ -500,7 +673,7 @@ func (v *VCS) Merge(targetBranch, sourceBranch string) error {
 func (v *VCS) writeCurrentBranch() error {
 	// 在.vcs資料夾中創建並寫入currentBranch
 	currentBranchFilePath := filepath.Join(v.repoDirectory, "currentBranch.txt")
-	err := os.WriteFile(currentBranchFilePath, []byte(v.currentBranch), 0644)
+	err := writeFileAtomic(currentBranchFilePath, []byte(v.currentBranch))
 	if err != nil {
 		return fmt.Errorf("unable to write current branch file: %v", err)
 	}
@@ -525,40 +698,82 @@ func (v *VCS) readCurrentBranch() error {
 	return nil
 }
 
-// 紀錄目前版本
-func (v *VCS) writeCurrentVersion() error {
-	// 在.vcs資料夾中創建並寫入currentVersion
-	currentVersionFilePath := filepath.Join(v.repoDirectory, "currentVersion.txt")
-	err := os.WriteFile(currentVersionFilePath, []byte(strconv.Itoa(v.currentVersion)), 0644)
+// 紀錄目前版本的提交編號
+func (v *VCS) writeCurrentCommit() error {
+	// 在.vcs資料夾中創建並寫入currentCommit
+	currentCommitFilePath := filepath.Join(v.repoDirectory, "currentCommit.txt")
+	oldID, _ := os.ReadFile(currentCommitFilePath)
+	err := writeFileAtomic(currentCommitFilePath, []byte(v.currentCommit))
 	if err != nil {
-		return fmt.Errorf("unable to write current branch file: %v", err)
+		return fmt.Errorf("unable to write current commit file: %v", err)
 	}
-	return nil
+	return appendReflog(v.headReflogPath(), strings.TrimSpace(string(oldID)), v.currentCommit)
 }
 
-// 載入目前版本
-func (v *VCS) readCurrentVersion() error {
-	currentVersionFilePath := filepath.Join(v.repoDirectory, "currentVersion.txt")
-
-	// 檢查檔案是否存在
-	if _, err1 := os.Stat(currentVersionFilePath); os.IsNotExist(err1) {
-		return fmt.Errorf("current branch file does not exist")
+// 載入目前版本的提交編號，尚未提交過時為空字串
+func (v *VCS) readCurrentCommit() error {
+	currentCommitFilePath := filepath.Join(v.repoDirectory, "currentCommit.txt")
+	id, err := os.ReadFile(currentCommitFilePath)
+	if os.IsNotExist(err) {
+		v.currentCommit = ""
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read current commit file: %v", err)
 	}
+	v.currentCommit = strings.TrimSpace(string(id))
+	return nil
+}
 
-	// 讀取當前版本編號
-	versionNumber, err2 := os.ReadFile(currentVersionFilePath)
+// 從檔案載入目前branch與目前版本
+func (v *VCS) loadState() error {
+	err1 := v.readCurrentBranch()
+	if err1 != nil {
+		return err1
+	}
+	err2 := v.readCurrentCommit()
 	if err2 != nil {
-		return fmt.Errorf("unable to read current branch file: %v", err2)
+		return err2
 	}
-	currentVersion, err3 := strconv.Atoi(string(versionNumber))
+
+	record, err3 := v.currentRecord()
 	if err3 != nil {
-		return fmt.Errorf("conversion error: %v", err3)
+		return err3
+	}
+	v.currentVersion = 0
+	if record != nil {
+		v.currentVersion = record.version
 	}
-	v.currentVersion = currentVersion
 	return nil
 }
 
-// 取得指定分支的目前版本
+// 讀取版本的清單，record為nil時回傳空清單
+func (v *VCS) recordManifest(record *commitRecord) (manifest, error) {
+	if record == nil {
+		return manifest{}, nil
+	}
+	return readManifest(record.directory)
+}
+
+// 取得branch下一個版本編號：接在branch資料夾與branch最新版本兩者中較大的編號之後
+func (v *VCS) nextVersionNumber(branch string, head *commitRecord) int {
+	version := v.getCurrentVersionOfBranch(branch)
+	if head != nil && head.version > version {
+		version = head.version
+	}
+	return version + 1
+}
+
+// 檢查branch或tag名稱是否可用，kind為錯誤訊息中的名稱種類
+func validateRefName(kind, name string) error {
+	if name == "" || name == "HEAD" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "-") ||
+		strings.ContainsAny(name, "/\\@~^:?*[{} \t") {
+		return fmt.Errorf("invalid %s name: %q", kind, name)
+	}
+	return nil
+}
+
+// 取得分支資料夾中最大的版本編號
 func (v *VCS) getCurrentVersionOfBranch(branch string) int {
 	branchDirectory := filepath.Join(v.historyDirectory, branch)
 	files, _ := os.ReadDir(branchDirectory)
@@ -596,11 +811,11 @@ func clearFolder(folderPath string) error {
 		return fmt.Errorf("unable to read folder: %v", err1)
 	}
 
-	// 遍歷資料夾中的每個檔案
+	// 遍歷資料夾中的每個檔案與子資料夾
 	for _, file := range files {
 		filePath := filepath.Join(folderPath, file.Name())
 		// 刪除檔案
-		err2 := os.Remove(filePath)
+		err2 := os.RemoveAll(filePath)
 		if err2 != nil {
 			return fmt.Errorf("failed to delete file %s: %v", filePath, err2)
 		}
@@ -608,63 +823,135 @@ func clearFolder(folderPath string) error {
 	return nil
 }
 
-// 複製文件
-func copyFile(sourcePath, destinationPath string) error {
-	// 讀取源文件
-	input, err := os.ReadFile(sourcePath)
+// 由下往上移除空資料夾，直到stopDirectory為止
+func removeEmptyParents(directory, stopDirectory string) {
+	for {
+		relativePath, err := filepath.Rel(stopDirectory, directory)
+		if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+			return
+		}
+		if os.Remove(directory) != nil {
+			return
+		}
+		directory = filepath.Dir(directory)
+	}
+}
+
+// 將路徑轉換成相對於工作目錄、以/分隔的路徑，不允許指向工作目錄外或.vcs資料夾內
+func (v *VCS) relativePath(name string) (string, error) {
+	absolutePath, err1 := filepath.Abs(name)
+	if err1 != nil {
+		return "", fmt.Errorf("invalid path %s: %v", name, err1)
+	}
+	absoluteWorkingDirectory, err2 := filepath.Abs(v.workingDirectory)
+	if err2 != nil {
+		return "", fmt.Errorf("invalid working directory: %v", err2)
+	}
+
+	path, err3 := filepath.Rel(absoluteWorkingDirectory, absolutePath)
+	if err3 != nil || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", name)
+	}
+	path = filepath.ToSlash(path)
+
+	repoPath, _ := filepath.Rel(v.workingDirectory, v.repoDirectory)
+	repoPath = filepath.ToSlash(repoPath)
+	if path == repoPath || strings.HasPrefix(path, repoPath+"/") {
+		return "", fmt.Errorf("%s is inside the repository folder", name)
+	}
+	return path, nil
+}
+
+// 取得檔案在暫存區中的位置
+func (v *VCS) stagedPath(path string) string {
+	return filepath.Join(v.filesDirectory, filepath.FromSlash(path))
+}
+
+// 取得工作區中的檔案位置
+func (v *VCS) workingPath(path string) string {
+	return filepath.Join(v.workingDirectory, filepath.FromSlash(path))
+}
+
+// 列出暫存區中所有檔案的相對路徑
+func (v *VCS) stagedPaths() ([]string, error) {
+	paths := []string{}
+	err := filepath.WalkDir(v.filesDirectory, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		path, _ := filepath.Rel(v.filesDirectory, filePath)
+		paths = append(paths, filepath.ToSlash(path))
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("unable to read source file %s: %v", sourcePath, err)
+		return nil, fmt.Errorf("unable to read folder: %v", err)
 	}
+	return paths, nil
+}
 
-	// 寫入到目標文件
-	err = os.WriteFile(destinationPath, input, 0644)
+// 寫入檔案，必要時先建立所在的資料夾
+func writeFileWithParents(filePath string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("unable to write to destination file %s: %v", destinationPath, err)
+		return err
 	}
-	return nil
+	return os.WriteFile(filePath, data, 0644)
 }
 
-// 建立branch的版本快照
-func (v *VCS) createVersionSnapshot(sourceVersionDirectory, destinationVersionDirectory string) error {
-	files, err1 := os.ReadDir(sourceVersionDirectory)
+// 先寫入同一資料夾中的暫存檔再改名取代原檔案，中斷時原檔案不會只寫入一半
+func writeFileAtomic(filePath string, data []byte) error {
+	err1 := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
 	if err1 != nil {
-		return fmt.Errorf("unable to read version directory: %v", err1)
+		return err1
 	}
 
-	// 清空暫存區資料夾
-	err2 := clearFolder(v.filesDirectory)
+	temporaryPath := filepath.Join(filepath.Dir(filePath), temporaryPrefix+filepath.Base(filePath)+temporarySuffix)
+	file, err2 := os.OpenFile(temporaryPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err2 != nil {
 		return err2
 	}
+	_, err3 := file.Write(data)
+	if err3 == nil {
+		err3 = file.Sync()
+	}
+	err4 := file.Close()
+	if err3 == nil {
+		err3 = err4
+	}
+	if err3 != nil {
+		os.Remove(temporaryPath)
+		return err3
+	}
+	return os.Rename(temporaryPath, filePath)
+}
 
-	// 取得.vcs的父資料夾，開發程式所在的工作目錄
-	workingDirectory := filepath.Dir(v.repoDirectory)
+// 將檔案內容以壓縮後的儲存格式寫入暫存區
+func writeStagedFile(stagedPath string, data []byte) error {
+	stored, err1 := encodeStoredFile(stagedPath, data)
+	if err1 != nil {
+		return err1
+	}
 
-	// 建立branch目錄下的版本快照
-	for _, file := range files {
-		// 將檔案複製到新的branch
-		sourcePath := filepath.Join(sourceVersionDirectory, file.Name())
-		destinationPath := filepath.Join(destinationVersionDirectory, file.Name())
-		err3 := copyFile(sourcePath, destinationPath)
-		if err3 != nil {
-			return fmt.Errorf("unable to copy file to branch: %v", err3)
-		}
+	err2 := writeFileWithParents(stagedPath, stored)
+	if err2 != nil {
+		return fmt.Errorf("unable to write staged file %s: %v", stagedPath, err2)
+	}
+	return nil
+}
 
-		if file.Name() != "commit_message.txt" {
-			// 複製到工作區
-			destinationPathRepo := filepath.Join(workingDirectory, file.Name())
-			err4 := copyFile(sourcePath, destinationPathRepo)
-			if err4 != nil {
-				return fmt.Errorf("unable to switch workspace version for %s: %v", file.Name(), err4)
-			}
+// 讀取暫存區檔案並解壓縮
+func readStagedFile(stagedPath string) ([]byte, error) {
+	stored, err1 := os.ReadFile(stagedPath)
+	if err1 != nil {
+		return nil, fmt.Errorf("unable to read staged file %s: %v", stagedPath, err1)
+	}
 
-			// 複製到暫存區
-			destinationPathFile := filepath.Join(v.filesDirectory, file.Name())
-			err5 := copyFile(sourcePath, destinationPathFile)
-			if err5 != nil {
-				return fmt.Errorf("unable to switch the staging area version for %s: %v", file.Name(), err5)
-			}
-		}
+	data, err2 := decodeStoredFile(stored)
+	if err2 != nil {
+		return nil, fmt.Errorf("corrupt staged file %s: %v", stagedPath, err2)
 	}
-	return nil
+	return data, nil
 }